@@ -0,0 +1,192 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"github.com/llitfkitfk/GoHighPerformance/pkg/db"
+	"gopkg.in/redis.v5"
+	"io/ioutil"
+	"os"
+)
+
+// The built-in backends, selected by Config.DBType. Backends in other
+// packages register themselves the same way from their own init functions.
+func init() {
+	db.Register("mem", openMem)
+	db.Register("sharded", openSharded)
+	db.Register("bounded", openBounded)
+	db.Register("disk", openDisk)
+	db.Register("redis", openRedis)
+	db.Register("layered", openLayered)
+}
+
+// backendConfig reads the application Config for a built-in backend.
+func backendConfig(process db.ConfigFunc) (*Config, error) {
+	var conf Config
+	if err := process(&conf); err != nil {
+		return nil, err
+	}
+	return &conf, nil
+}
+
+func openMem(process db.ConfigFunc) (db.DB, error) {
+	conf, err := backendConfig(process)
+	if err != nil {
+		return nil, err
+	}
+	var mem *db.Mem
+	if conf.MemCopyOnSave {
+		mem = db.NewMemCopy()
+	} else {
+		mem = db.NewMem()
+	}
+	if conf.MemSnapshotPath != "" {
+		if err := mem.LoadSnapshot(conf.MemSnapshotPath); err != nil && !os.IsNotExist(err) {
+			return nil, fmt.Errorf("loading snapshot %s: %s", conf.MemSnapshotPath, err)
+		}
+	}
+	mem.StartJanitor(conf.MemJanitorInterval)
+	return mem, nil
+}
+
+func openSharded(process db.ConfigFunc) (db.DB, error) {
+	conf, err := backendConfig(process)
+	if err != nil {
+		return nil, err
+	}
+	mem := db.NewShardedMem(conf.MemShards)
+	mem.StartJanitor(conf.MemJanitorInterval)
+	return mem, nil
+}
+
+func openBounded(process db.ConfigFunc) (db.DB, error) {
+	conf, err := backendConfig(process)
+	if err != nil {
+		return nil, err
+	}
+	return db.NewBoundedMem(db.EvictionPolicy(conf.MemEvictionPolicy), conf.MemMaxEntries, conf.MemMaxBytes)
+}
+
+func openDisk(process db.ConfigFunc) (db.DB, error) {
+	conf, err := backendConfig(process)
+	if err != nil {
+		return nil, err
+	}
+	return db.OpenDisk(conf.DataDir, db.DiskOptions{
+		Sync:            db.SyncPolicy(conf.DiskSync),
+		SyncInterval:    conf.DiskSyncInterval,
+		CompactInterval: conf.DiskCompactInterval,
+		CompactRatio:    conf.DiskCompactRatio,
+	})
+}
+
+func openRedis(process db.ConfigFunc) (db.DB, error) {
+	conf, err := backendConfig(process)
+	if err != nil {
+		return nil, err
+	}
+	return newRedis(conf)
+}
+
+func openLayered(process db.ConfigFunc) (db.DB, error) {
+	conf, err := backendConfig(process)
+	if err != nil {
+		return nil, err
+	}
+	rdb, err := newRedis(conf)
+	if err != nil {
+		return nil, err
+	}
+	return db.NewLayered(db.NewMemCopy(), rdb, db.CacheMode(conf.CacheMode), conf.CacheNegativeTTL, conf.CacheQueueSize)
+}
+
+func newRedis(conf *Config) (*db.Redis, error) {
+	redisClient, err := newRedisClient(conf)
+	if err != nil {
+		return nil, err
+	}
+	rdb := db.NewRedis(redisClient)
+	if conf.RedisPublishChanges {
+		rdb.PublishChanges()
+	}
+	return rdb, nil
+}
+
+// newRedisClient connects to a Redis cluster if cluster nodes are configured,
+// to the master known to Sentinel if a master name is, and to RedisHost
+// otherwise. Only the standalone client supports TLS, which validate enforces.
+func newRedisClient(conf *Config) (db.RedisClient, error) {
+	switch {
+	case len(conf.RedisClusterAddrs) > 0:
+		return redis.NewClusterClient(&redis.ClusterOptions{
+			Addrs:              conf.RedisClusterAddrs,
+			Password:           conf.RedisPass,
+			PoolSize:           conf.RedisPoolSize,
+			DialTimeout:        conf.RedisDialTimeout,
+			ReadTimeout:        conf.RedisReadTimeout,
+			WriteTimeout:       conf.RedisWriteTimeout,
+			PoolTimeout:        conf.RedisPoolTimeout,
+			IdleTimeout:        conf.RedisIdleTimeout,
+			IdleCheckFrequency: conf.RedisIdleCheckFrequency,
+		}), nil
+	case conf.RedisSentinelMaster != "":
+		return redis.NewFailoverClient(&redis.FailoverOptions{
+			MasterName:         conf.RedisSentinelMaster,
+			SentinelAddrs:      conf.RedisSentinelAddrs,
+			Password:           conf.RedisPass,
+			DB:                 int(conf.RedisDB),
+			PoolSize:           conf.RedisPoolSize,
+			DialTimeout:        conf.RedisDialTimeout,
+			ReadTimeout:        conf.RedisReadTimeout,
+			WriteTimeout:       conf.RedisWriteTimeout,
+			PoolTimeout:        conf.RedisPoolTimeout,
+			IdleTimeout:        conf.RedisIdleTimeout,
+			IdleCheckFrequency: conf.RedisIdleCheckFrequency,
+		}), nil
+	default:
+		tlsConfig, err := redisTLSConfig(conf)
+		if err != nil {
+			return nil, err
+		}
+		return redis.NewClient(&redis.Options{
+			Addr:               conf.RedisHost,
+			Password:           conf.RedisPass,
+			DB:                 int(conf.RedisDB),
+			PoolSize:           conf.RedisPoolSize,
+			DialTimeout:        conf.RedisDialTimeout,
+			ReadTimeout:        conf.RedisReadTimeout,
+			WriteTimeout:       conf.RedisWriteTimeout,
+			PoolTimeout:        conf.RedisPoolTimeout,
+			IdleTimeout:        conf.RedisIdleTimeout,
+			IdleCheckFrequency: conf.RedisIdleCheckFrequency,
+			TLSConfig:          tlsConfig,
+		}), nil
+	}
+}
+
+// redisTLSConfig builds the TLS settings for Redis, or returns nil if TLS is off.
+func redisTLSConfig(conf *Config) (*tls.Config, error) {
+	if !conf.RedisTLS {
+		return nil, nil
+	}
+	tlsConfig := &tls.Config{InsecureSkipVerify: conf.RedisTLSSkipVerify}
+	if conf.RedisTLSCAFile != "" {
+		pem, err := ioutil.ReadFile(conf.RedisTLSCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("reading redis_tls_ca_file: %s", err)
+		}
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("redis_tls_ca_file %s contains no PEM certificates", conf.RedisTLSCAFile)
+		}
+	}
+	if conf.RedisTLSCertFile != "" {
+		cert, err := tls.LoadX509KeyPair(conf.RedisTLSCertFile, conf.RedisTLSKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("loading redis_tls_cert_file and redis_tls_key_file: %s", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	return tlsConfig, nil
+}
@@ -1,7 +1,10 @@
 package main
 
 import (
+	"errors"
+	"fmt"
 	"github.com/kelseyhightower/envconfig"
+	"time"
 )
 
 const AppName = "GoHighPerformance"
@@ -12,13 +15,114 @@ type Config struct {
 	RedisHost string `envconfig:"redis_host" default:"localhost:6379"`
 	RedisPass string `envconfig:"redis_pass" default:""` // default to no password
 	RedisDB   int64  `envconfig:"redis_db" default:"0"`  // default to the redis default DB
+
+	// Sentinel and Cluster setups, which take precedence over RedisHost.
+	// Lists are comma separated.
+	RedisSentinelMaster string   `envconfig:"redis_sentinel_master" default:""`
+	RedisSentinelAddrs  []string `envconfig:"redis_sentinel_addrs"`
+	RedisClusterAddrs   []string `envconfig:"redis_cluster_addrs"`
+
+	// connection pool, 0 keeps the client's default. redis.v5 has no option to
+	// keep a minimum of idle connections open, so there is no setting for it.
+	RedisPoolSize           int           `envconfig:"redis_pool_size" default:"0"`
+	RedisDialTimeout        time.Duration `envconfig:"redis_dial_timeout" default:"5s"`
+	RedisReadTimeout        time.Duration `envconfig:"redis_read_timeout" default:"3s"`
+	RedisWriteTimeout       time.Duration `envconfig:"redis_write_timeout" default:"3s"`
+	RedisPoolTimeout        time.Duration `envconfig:"redis_pool_timeout" default:"0"`
+	RedisIdleTimeout        time.Duration `envconfig:"redis_idle_timeout" default:"5m"`
+	RedisIdleCheckFrequency time.Duration `envconfig:"redis_idle_check_frequency" default:"1m"`
+
+	// TLS, standalone only; the cert and key files enable client authentication
+	RedisTLS           bool   `envconfig:"redis_tls" default:"false"`
+	RedisTLSCAFile     string `envconfig:"redis_tls_ca_file" default:""` // default to the system roots
+	RedisTLSCertFile   string `envconfig:"redis_tls_cert_file" default:""`
+	RedisTLSKeyFile    string `envconfig:"redis_tls_key_file" default:""`
+	RedisTLSSkipVerify bool   `envconfig:"redis_tls_skip_verify" default:"false"` // for development only
+
+	DBCoalesceGets bool          `envconfig:"db_coalesce_gets" default:"false"` // share concurrent Gets of the same key
+	ReadyTimeout   time.Duration `envconfig:"ready_timeout" default:"1s"`       // how long /readyz waits for the DB ping
+
+	RedisPublishChanges bool `envconfig:"redis_publish_changes" default:"false"` // publish writes for watchers
+
+	// settings for db_type=layered, a mem cache in front of redis
+	CacheMode        string        `envconfig:"cache_mode" default:"read-through"` // read-through, write-through or write-behind
+	CacheNegativeTTL time.Duration `envconfig:"cache_negative_ttl" default:"5s"`   // how long misses are cached, 0 disables
+	CacheQueueSize   int           `envconfig:"cache_queue_size" default:"1024"`   // pending writes in write-behind mode
+
+	MemJanitorInterval time.Duration `envconfig:"mem_janitor_interval" default:"1m"` // how often mem drops expired keys
+	MemShards          int           `envconfig:"mem_shards" default:"64"`           // shard count for db_type=sharded
+	MemCopyOnSave      bool          `envconfig:"mem_copy_on_save" default:"false"`  // store MarshalBinary snapshots in db_type=mem
+	MemSnapshotPath    string        `envconfig:"mem_snapshot_path" default:""`      // snapshot file for db_type=mem, empty disables
+
+	// limits for db_type=bounded, 0 means unlimited
+	MemMaxEntries     int    `envconfig:"mem_max_entries" default:"0"`
+	MemMaxBytes       int64  `envconfig:"mem_max_bytes" default:"0"`
+	MemEvictionPolicy string `envconfig:"mem_eviction_policy" default:"lru"` // lru or lfu
+
+	// settings for db_type=disk
+	DataDir             string        `envconfig:"data_dir" default:"data"`
+	DiskSync            string        `envconfig:"disk_sync" default:"interval"` // always, interval or never
+	DiskSyncInterval    time.Duration `envconfig:"disk_sync_interval" default:"1s"`
+	DiskCompactInterval time.Duration `envconfig:"disk_compact_interval" default:"5m"` // 0 disables compaction
+	DiskCompactRatio    float64       `envconfig:"disk_compact_ratio" default:"0.5"`   // compact once this share of the log is stale
 }
 
 // GetConfig uses envconfig to populate and return a Config struct. Returns all envconfig errors if they occurred
 func GetConfig() (*Config, error) {
 	var conf Config
-	if err := envconfig.Process(AppName, &conf); err != nil {
+	if err := processConfig(&conf); err != nil {
+		return nil, err
+	}
+	if err := conf.validate(); err != nil {
 		return nil, err
 	}
 	return &conf, nil
-}
\ No newline at end of file
+}
+
+// processConfig fills spec from the environment with envconfig. It is the
+// db.ConfigFunc handed to backend factories.
+func processConfig(spec interface{}) error {
+	return envconfig.Process(AppName, spec)
+}
+
+func (c *Config) validate() error {
+	if c.RedisSentinelMaster != "" && len(c.RedisSentinelAddrs) == 0 {
+		return errors.New("redis_sentinel_master is set but redis_sentinel_addrs is empty")
+	}
+	if len(c.RedisSentinelAddrs) > 0 && c.RedisSentinelMaster == "" {
+		return errors.New("redis_sentinel_addrs is set but redis_sentinel_master is empty")
+	}
+	if c.RedisSentinelMaster != "" && len(c.RedisClusterAddrs) > 0 {
+		return errors.New("redis_sentinel_master and redis_cluster_addrs are mutually exclusive")
+	}
+	if len(c.RedisClusterAddrs) > 0 && c.RedisDB != 0 {
+		return errors.New("redis_db must be 0 with redis_cluster_addrs, clusters only have DB 0")
+	}
+
+	if c.RedisPoolSize < 0 {
+		return fmt.Errorf("redis_pool_size must not be negative, got %d", c.RedisPoolSize)
+	}
+	for name, d := range map[string]time.Duration{
+		"redis_dial_timeout":         c.RedisDialTimeout,
+		"redis_read_timeout":         c.RedisReadTimeout,
+		"redis_write_timeout":        c.RedisWriteTimeout,
+		"redis_pool_timeout":         c.RedisPoolTimeout,
+		"redis_idle_timeout":         c.RedisIdleTimeout,
+		"redis_idle_check_frequency": c.RedisIdleCheckFrequency,
+	} {
+		if d < 0 {
+			return fmt.Errorf("%s must not be negative, got %s", name, d)
+		}
+	}
+
+	if !c.RedisTLS && (c.RedisTLSCAFile != "" || c.RedisTLSCertFile != "" || c.RedisTLSKeyFile != "" || c.RedisTLSSkipVerify) {
+		return errors.New("redis_tls_* options are set but redis_tls is false")
+	}
+	if c.RedisTLS && (c.RedisSentinelMaster != "" || len(c.RedisClusterAddrs) > 0) {
+		return errors.New("redis_tls is only supported with redis_host, the redis.v5 sentinel and cluster clients have no TLS")
+	}
+	if (c.RedisTLSCertFile == "") != (c.RedisTLSKeyFile == "") {
+		return errors.New("redis_tls_cert_file and redis_tls_key_file must be set together")
+	}
+	return nil
+}
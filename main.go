@@ -5,11 +5,12 @@ import (
 	"github.com/gorilla/mux"
 	"github.com/llitfkitfk/GoHighPerformance/pkg/db"
 	"github.com/llitfkitfk/GoHighPerformance/pkg/handler"
-	"gopkg.in/redis.v5"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
 	"runtime"
+	"syscall"
 )
 
 func init() {
@@ -29,30 +30,58 @@ func main() {
 		os.Exit(1)
 	}
 
-	var database db.DB
-	switch conf.DBType {
-	case "mem":
-		database = db.NewMem()
-	case "redis":
-		redisOpts := &redis.Options{
-			Addr:     conf.RedisHost,
-			Password: conf.RedisPass,
-			DB:       int(conf.RedisDB),
-		}
-		redisClient := redis.NewClient(redisOpts)
-		database = db.NewRedis(redisClient)
-
-	default:
-		log.Printf("Error: no available DB type %s", conf.DBType)
+	database, err := db.Open(conf.DBType, processConfig)
+	if err != nil {
+		log.Printf("Error opening %s DB [%s]", conf.DBType, err)
 		os.Exit(1)
 	}
+	// keep the unwrapped backend for the checks that need its own interfaces
+	backend := database
+	var snapshotter db.Snapshotter
+	if s, ok := database.(db.Snapshotter); ok && conf.MemSnapshotPath != "" {
+		snapshotter = s
+		go snapshotOnSignal(s, conf.MemSnapshotPath)
+	}
+
+	var metrics []handler.PrometheusWriter
+	if conf.DBCoalesceGets {
+		coalesced := db.NewCoalesced(database)
+		database = coalesced
+		metrics = append(metrics, coalesced)
+	}
+	instrumented := db.NewInstrumented(database)
+	database = instrumented
+	metrics = append(metrics, instrumented)
 
 	router := mux.NewRouter()
 
-	handler.NewCreateHandler(database).RegisterRoute(router)
+	handler.NewMetricsHandler(metrics...).RegisterRoute(router)
+	handler.NewHealthHandler().RegisterRoute(router)
+	handler.NewReadyHandler(backend, conf.ReadyTimeout).RegisterRoute(router)
+	if snapshotter != nil {
+		handler.NewSnapshotHandler(snapshotter, conf.MemSnapshotPath).RegisterRoute(router)
+	}
+	handler.RegisterResources(router, database)
 
 	portStr := fmt.Sprintf(":%d", conf.Port)
 	log.Printf("Serving on %s", portStr)
 	log.Fatal(http.ListenAndServe(portStr, router))
 
 }
+
+// snapshotOnSignal writes a snapshot to path on SIGUSR1, and a final one before
+// exiting on SIGINT or SIGTERM so a redeploy keeps the data.
+func snapshotOnSignal(s db.Snapshotter, path string) {
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, syscall.SIGUSR1, syscall.SIGINT, syscall.SIGTERM)
+	for sig := range c {
+		if err := s.SaveSnapshot(path); err != nil {
+			log.Printf("Error writing snapshot %s [%s]", path, err)
+		} else {
+			log.Printf("Wrote snapshot %s", path)
+		}
+		if sig != syscall.SIGUSR1 {
+			os.Exit(0)
+		}
+	}
+}
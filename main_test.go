@@ -1,6 +1,76 @@
 package main
 
-import "testing"
+import (
+	"gopkg.in/redis.v5"
+	"testing"
+	"time"
+)
 
-func TestDecode(t *testing.T)  {
-}
\ No newline at end of file
+func TestDecode(t *testing.T) {
+}
+
+func TestConfigValidateRedis(t *testing.T) {
+	for _, c := range []struct {
+		name string
+		conf Config
+		ok   bool
+	}{
+		{"standalone", Config{}, true},
+		{"sentinel", Config{RedisSentinelMaster: "mymaster", RedisSentinelAddrs: []string{"s1:26379"}}, true},
+		{"sentinel without addrs", Config{RedisSentinelMaster: "mymaster"}, false},
+		{"sentinel addrs without master", Config{RedisSentinelAddrs: []string{"s1:26379"}}, false},
+		{"cluster", Config{RedisClusterAddrs: []string{"n1:6379", "n2:6379"}}, true},
+		{"cluster with db", Config{RedisClusterAddrs: []string{"n1:6379"}, RedisDB: 1}, false},
+		{"sentinel and cluster", Config{RedisSentinelMaster: "m", RedisSentinelAddrs: []string{"s"}, RedisClusterAddrs: []string{"n"}}, false},
+		{"pool", Config{RedisPoolSize: 20}, true},
+		{"negative pool size", Config{RedisPoolSize: -1}, false},
+		{"negative timeout", Config{RedisReadTimeout: -time.Second}, false},
+		{"tls", Config{RedisTLS: true, RedisTLSCertFile: "c.pem", RedisTLSKeyFile: "k.pem"}, true},
+		{"tls files without tls", Config{RedisTLSCAFile: "ca.pem"}, false},
+		{"cert without key", Config{RedisTLS: true, RedisTLSCertFile: "c.pem"}, false},
+		{"tls with sentinel", Config{RedisTLS: true, RedisSentinelMaster: "m", RedisSentinelAddrs: []string{"s"}}, false},
+		{"tls with cluster", Config{RedisTLS: true, RedisClusterAddrs: []string{"n"}}, false},
+	} {
+		if err := c.conf.validate(); (err == nil) != c.ok {
+			t.Errorf("%s: validate() = %v, want ok=%v", c.name, err, c.ok)
+		}
+	}
+}
+
+// TestNewRedisClient builds the client for every mode from a validated Config,
+// so an option the pinned client lacks fails here rather than in production.
+func TestNewRedisClient(t *testing.T) {
+	for _, c := range []struct {
+		name    string
+		conf    Config
+		cluster bool
+	}{
+		{"standalone", Config{RedisHost: "127.0.0.1:0", RedisTLS: true}, false},
+		{"sentinel", Config{RedisSentinelMaster: "mymaster", RedisSentinelAddrs: []string{"127.0.0.1:0"}}, false},
+		{"cluster", Config{RedisClusterAddrs: []string{"127.0.0.1:0"}}, true},
+	} {
+		c.conf.RedisPoolSize = 4
+		c.conf.RedisIdleTimeout = time.Minute
+		if err := c.conf.validate(); err != nil {
+			t.Fatalf("%s: validate() = %s", c.name, err)
+		}
+		client, err := newRedisClient(&c.conf)
+		if err != nil {
+			t.Fatalf("%s: newRedisClient: %s", c.name, err)
+		}
+		switch client := client.(type) {
+		case *redis.ClusterClient:
+			if !c.cluster {
+				t.Errorf("%s: got a cluster client", c.name)
+			}
+			client.Close()
+		case *redis.Client:
+			if c.cluster {
+				t.Errorf("%s: got a single-node client", c.name)
+			}
+			client.Close()
+		default:
+			t.Errorf("%s: unexpected client %T", c.name, client)
+		}
+	}
+}
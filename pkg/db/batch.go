@@ -0,0 +1,90 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"github.com/llitfkitfk/GoHighPerformance/pkg/model"
+)
+
+var ErrBatchSize = errors.New("batch keys and models differ in length")
+
+// Batch is implemented by backends that can operate on many keys in one call.
+// A failure on one key does not abort the others; see BatchError.
+type Batch interface {
+	SaveMany([]model.Key, []model.Model) error
+
+	GetMany([]model.Key, []model.Model) error
+
+	DeleteMany([]model.Key) error
+}
+
+// BatchError is returned by Batch operations when at least one key failed. It
+// is index-aligned with the keys passed in; a nil entry means that key succeeded.
+type BatchError []error
+
+func (e BatchError) Error() string {
+	var n int
+	var first error
+	for _, err := range e {
+		if err != nil {
+			if first == nil {
+				first = err
+			}
+			n++
+		}
+	}
+	return fmt.Sprintf("%d of %d batch operations failed, first error: %s", n, len(e), first)
+}
+
+// batchErr returns errs as a BatchError if any of them is non-nil.
+func batchErr(errs []error) error {
+	for _, err := range errs {
+		if err != nil {
+			return BatchError(errs)
+		}
+	}
+	return nil
+}
+
+// WithBatch returns a Batch for db. If db does not implement Batch itself, the
+// returned Batch loops over the plain DB methods one key at a time.
+func WithBatch(db DB) Batch {
+	if b, ok := db.(Batch); ok {
+		return b
+	}
+	return loopBatch{db: db}
+}
+
+type loopBatch struct {
+	db DB
+}
+
+func (l loopBatch) SaveMany(keys []model.Key, models []model.Model) error {
+	if len(keys) != len(models) {
+		return ErrBatchSize
+	}
+	errs := make([]error, len(keys))
+	for i, key := range keys {
+		errs[i] = l.db.Save(key, models[i])
+	}
+	return batchErr(errs)
+}
+
+func (l loopBatch) GetMany(keys []model.Key, models []model.Model) error {
+	if len(keys) != len(models) {
+		return ErrBatchSize
+	}
+	errs := make([]error, len(keys))
+	for i, key := range keys {
+		errs[i] = l.db.Get(key, models[i])
+	}
+	return batchErr(errs)
+}
+
+func (l loopBatch) DeleteMany(keys []model.Key) error {
+	errs := make([]error, len(keys))
+	for i, key := range keys {
+		errs[i] = l.db.Delete(key)
+	}
+	return batchErr(errs)
+}
@@ -0,0 +1,55 @@
+package db
+
+import (
+	"github.com/llitfkitfk/GoHighPerformance/pkg/model"
+	"testing"
+)
+
+func testBatch(t *testing.T, b Batch) {
+	keys := []model.Key{testKey("a"), testKey("b")}
+	if err := b.SaveMany(keys, []model.Model{&testModel{Val: "1"}, &testModel{Val: "2"}}); err != nil {
+		t.Fatalf("SaveMany: %s", err)
+	}
+
+	got := []model.Model{&testModel{}, &testModel{}, &testModel{}}
+	err := b.GetMany(append(keys, testKey("missing")), got)
+	berr, ok := err.(BatchError)
+	if !ok {
+		t.Fatalf("GetMany error = %v, want BatchError", err)
+	}
+	if berr[0] != nil || berr[1] != nil || berr[2] != ErrNotFound {
+		t.Fatalf("GetMany errors = %v, want [nil nil ErrNotFound]", []error(berr))
+	}
+	if got[0].(*testModel).Val != "1" || got[1].(*testModel).Val != "2" {
+		t.Fatalf("GetMany = %v, %v", got[0], got[1])
+	}
+
+	if err := b.DeleteMany(keys); err != nil {
+		t.Fatalf("DeleteMany: %s", err)
+	}
+	if err := b.GetMany(keys, got[:2]); err == nil {
+		t.Fatal("GetMany after DeleteMany returned nil error")
+	}
+
+	if err := b.SaveMany(keys, got[:1]); err != ErrBatchSize {
+		t.Fatalf("SaveMany with mismatched lengths = %v, want ErrBatchSize", err)
+	}
+}
+
+func TestMemBatch(t *testing.T) {
+	testBatch(t, NewMem())
+}
+
+func TestLoopBatch(t *testing.T) {
+	b := WithBatch(plainDB{cdb: NewMem()})
+	if _, ok := b.(loopBatch); !ok {
+		t.Fatalf("WithBatch(plainDB) = %T, want loopBatch", b)
+	}
+	testBatch(t, b)
+}
+
+func TestRedisBatch(t *testing.T) {
+	r, s := newTestRedis(t)
+	defer s.Close()
+	testBatch(t, r)
+}
@@ -0,0 +1,174 @@
+package db
+
+import (
+	"container/heap"
+	"errors"
+	"fmt"
+	"github.com/llitfkitfk/GoHighPerformance/pkg/model"
+	"sync"
+)
+
+var ErrTooLarge = errors.New("model exceeds the store's byte limit")
+
+// EvictionPolicy selects which entry BoundedMem drops when it is full.
+type EvictionPolicy string
+
+const (
+	LRU EvictionPolicy = "lru" // least recently used
+	LFU EvictionPolicy = "lfu" // least frequently used, ties broken by recency
+)
+
+// BoundedStats is a point-in-time view of a BoundedMem.
+type BoundedStats struct {
+	Entries   int
+	Bytes     int64
+	Evictions uint64
+}
+
+// BoundedMem is an in-memory store that evicts entries once it holds more than
+// maxEntries entries or maxBytes bytes, sizes being MarshalBinary lengths. A
+// limit <= 0 is not enforced.
+type BoundedMem struct {
+	mx         sync.Mutex
+	m          map[string]*boundedEntry
+	h          boundedHeap
+	policy     EvictionPolicy
+	maxEntries int
+	maxBytes   int64
+	bytes      int64
+	tick       uint64
+	evictions  uint64
+}
+
+func NewBoundedMem(policy EvictionPolicy, maxEntries int, maxBytes int64) (*BoundedMem, error) {
+	if policy != LRU && policy != LFU {
+		return nil, fmt.Errorf("unknown eviction policy %q, want %q or %q", policy, LRU, LFU)
+	}
+	b := &BoundedMem{
+		m:          make(map[string]*boundedEntry),
+		policy:     policy,
+		maxEntries: maxEntries,
+		maxBytes:   maxBytes,
+	}
+	b.h.policy = policy
+	return b, nil
+}
+
+func (b *BoundedMem) Save(key model.Key, model model.Model) error {
+	data, err := model.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	size := int64(len(data))
+	if b.maxBytes > 0 && size > b.maxBytes {
+		return ErrTooLarge
+	}
+
+	b.mx.Lock()
+	defer b.mx.Unlock()
+	k := key.String()
+	var freq uint64
+	if e, ok := b.m[k]; ok {
+		freq = e.freq
+		b.remove(e)
+	}
+	for b.full(size) {
+		b.remove(b.h.entries[0])
+		b.evictions++
+	}
+	b.tick++
+	e := &boundedEntry{key: k, model: model, size: size, freq: freq + 1, tick: b.tick}
+	b.m[k] = e
+	b.bytes += size
+	heap.Push(&b.h, e)
+	return nil
+}
+
+func (b *BoundedMem) Delete(key model.Key) error {
+	b.mx.Lock()
+	defer b.mx.Unlock()
+	if e, ok := b.m[key.String()]; ok {
+		b.remove(e)
+	}
+	return nil
+}
+
+func (b *BoundedMem) Get(key model.Key, model model.Model) error {
+	b.mx.Lock()
+	defer b.mx.Unlock()
+	e, ok := b.m[key.String()]
+	if !ok {
+		return ErrNotFound
+	}
+	b.tick++
+	e.tick = b.tick
+	e.freq++
+	heap.Fix(&b.h, e.index)
+	return model.Set(e.model)
+}
+
+func (b *BoundedMem) Stats() BoundedStats {
+	b.mx.Lock()
+	defer b.mx.Unlock()
+	return BoundedStats{Entries: len(b.m), Bytes: b.bytes, Evictions: b.evictions}
+}
+
+// full reports whether adding an entry of size bytes would break a limit.
+func (b *BoundedMem) full(size int64) bool {
+	if len(b.m) == 0 {
+		return false
+	}
+	return (b.maxEntries > 0 && len(b.m) >= b.maxEntries) ||
+		(b.maxBytes > 0 && b.bytes+size > b.maxBytes)
+}
+
+func (b *BoundedMem) remove(e *boundedEntry) {
+	heap.Remove(&b.h, e.index)
+	delete(b.m, e.key)
+	b.bytes -= e.size
+}
+
+type boundedEntry struct {
+	key   string
+	model model.Model
+	size  int64
+	freq  uint64 // number of saves and gets
+	tick  uint64 // logical time of the last access
+	index int    // position in boundedHeap
+}
+
+// boundedHeap keeps the next entry to evict at index 0.
+type boundedHeap struct {
+	policy  EvictionPolicy
+	entries []*boundedEntry
+}
+
+func (h *boundedHeap) Len() int { return len(h.entries) }
+
+func (h *boundedHeap) Less(i, j int) bool {
+	a, b := h.entries[i], h.entries[j]
+	if h.policy == LFU && a.freq != b.freq {
+		return a.freq < b.freq
+	}
+	return a.tick < b.tick
+}
+
+func (h *boundedHeap) Swap(i, j int) {
+	h.entries[i], h.entries[j] = h.entries[j], h.entries[i]
+	h.entries[i].index = i
+	h.entries[j].index = j
+}
+
+func (h *boundedHeap) Push(x interface{}) {
+	e := x.(*boundedEntry)
+	e.index = len(h.entries)
+	h.entries = append(h.entries, e)
+}
+
+func (h *boundedHeap) Pop() interface{} {
+	n := len(h.entries) - 1
+	e := h.entries[n]
+	h.entries[n] = nil
+	h.entries = h.entries[:n]
+	return e
+}
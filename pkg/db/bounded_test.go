@@ -0,0 +1,61 @@
+package db
+
+import "testing"
+
+func TestBoundedMemLRU(t *testing.T) {
+	b, _ := NewBoundedMem(LRU, 2, 0)
+	b.Save(testKey("a"), &testModel{Val: "a"})
+	b.Save(testKey("b"), &testModel{Val: "b"})
+
+	var m testModel
+	b.Get(testKey("a"), &m) // b is now least recently used
+	b.Save(testKey("c"), &testModel{Val: "c"})
+
+	if err := b.Get(testKey("b"), &m); err != ErrNotFound {
+		t.Fatalf("Get(b) = %v, want ErrNotFound", err)
+	}
+	for _, k := range []testKey{"a", "c"} {
+		if err := b.Get(k, &m); err != nil {
+			t.Fatalf("Get(%s): %s", k, err)
+		}
+	}
+	if s := b.Stats(); s.Entries != 2 || s.Evictions != 1 {
+		t.Fatalf("Stats = %+v, want 2 entries and 1 eviction", s)
+	}
+}
+
+func TestBoundedMemLFU(t *testing.T) {
+	b, _ := NewBoundedMem(LFU, 2, 0)
+	b.Save(testKey("a"), &testModel{Val: "a"})
+	b.Save(testKey("b"), &testModel{Val: "b"})
+
+	var m testModel
+	b.Get(testKey("a"), &m)
+	b.Get(testKey("a"), &m)
+	b.Get(testKey("b"), &m) // b is more recent but less frequent than a
+	b.Save(testKey("c"), &testModel{Val: "c"})
+
+	if err := b.Get(testKey("b"), &m); err != ErrNotFound {
+		t.Fatalf("Get(b) = %v, want ErrNotFound", err)
+	}
+	if err := b.Get(testKey("a"), &m); err != nil {
+		t.Fatalf("Get(a): %s", err)
+	}
+}
+
+func TestBoundedMemMaxBytes(t *testing.T) {
+	b, _ := NewBoundedMem(LRU, 0, 10)
+	b.Save(testKey("a"), &testModel{Val: "12345"})
+	b.Save(testKey("b"), &testModel{Val: "12345"})
+	b.Save(testKey("c"), &testModel{Val: "123"})
+
+	if s := b.Stats(); s.Entries != 2 || s.Bytes != 8 || s.Evictions != 1 {
+		t.Fatalf("Stats = %+v, want 2 entries, 8 bytes, 1 eviction", s)
+	}
+	if err := b.Save(testKey("d"), &testModel{Val: "12345678901"}); err != ErrTooLarge {
+		t.Fatalf("Save of oversized model = %v, want ErrTooLarge", err)
+	}
+	if _, err := NewBoundedMem("fifo", 1, 0); err == nil {
+		t.Fatal("NewBoundedMem accepted an unknown policy")
+	}
+}
@@ -0,0 +1,213 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"github.com/llitfkitfk/GoHighPerformance/pkg/model"
+	"io"
+	"sync"
+	"sync/atomic"
+)
+
+// Coalesced wraps a DB so that concurrent Gets for the same key share a single
+// call to it. The first caller's model is filled by the DB and the others copy
+// it through their own model's Set. GetVersion calls are shared the same way,
+// separately from Gets; everything else is passed through.
+type Coalesced struct {
+	db  DB
+	cdb ContextDB
+
+	mx           sync.Mutex
+	calls        map[string]*coalescedCall
+	versionCalls map[string]*coalescedCall
+
+	backend      uint64
+	deduplicated uint64
+}
+
+type coalescedCall struct {
+	done      chan struct{}
+	model     model.Model
+	version   string
+	err       error
+	followers sync.WaitGroup
+}
+
+// CoalescedStats counts Gets that reached the wrapped DB and Gets that were
+// answered from another caller's in-flight call.
+type CoalescedStats struct {
+	Backend      uint64
+	Deduplicated uint64
+}
+
+func NewCoalesced(db DB) *Coalesced {
+	return &Coalesced{
+		db:           db,
+		cdb:          WithContext(db),
+		calls:        make(map[string]*coalescedCall),
+		versionCalls: make(map[string]*coalescedCall),
+	}
+}
+
+// Unwrap returns the wrapped DB.
+func (c *Coalesced) Unwrap() DB {
+	return c.db
+}
+
+func (c *Coalesced) Save(key model.Key, model model.Model) error {
+	return c.db.Save(key, model)
+}
+
+func (c *Coalesced) Delete(key model.Key) error {
+	return c.db.Delete(key)
+}
+
+func (c *Coalesced) Get(key model.Key, model model.Model) error {
+	return c.GetContext(context.Background(), key, model)
+}
+
+func (c *Coalesced) SaveContext(ctx context.Context, key model.Key, model model.Model) error {
+	return c.cdb.SaveContext(ctx, key, model)
+}
+
+func (c *Coalesced) DeleteContext(ctx context.Context, key model.Key) error {
+	return c.cdb.DeleteContext(ctx, key)
+}
+
+// GetContext is Get that stops waiting for another caller's call when ctx is
+// done. The call itself runs with the first caller's ctx; if that ends it
+// early, the callers still waiting make a new one.
+func (c *Coalesced) GetContext(ctx context.Context, key model.Key, model model.Model) error {
+	_, err := c.share(ctx, c.calls, key.String(), model, func() (string, error) {
+		return "", c.cdb.GetContext(ctx, key, model)
+	})
+	return err
+}
+
+func (c *Coalesced) GetVersion(key model.Key, model model.Model) (string, error) {
+	return c.GetVersionContext(context.Background(), key, model)
+}
+
+func (c *Coalesced) GetVersionContext(ctx context.Context, key model.Key, model model.Model) (string, error) {
+	v, ok := c.db.(VersionedDB)
+	if !ok {
+		return "", errNotVersioned
+	}
+	return c.share(ctx, c.versionCalls, key.String(), model, func() (string, error) {
+		return v.GetVersionContext(ctx, key, model)
+	})
+}
+
+// share runs fetch, which fills model, unless a call for k is already in
+// flight in calls, in which case it waits for that one and copies its result.
+func (c *Coalesced) share(ctx context.Context, calls map[string]*coalescedCall, k string, model model.Model, fetch func() (string, error)) (string, error) {
+	for {
+		c.mx.Lock()
+		call, ok := calls[k]
+		if !ok {
+			break
+		}
+		call.followers.Add(1)
+		c.mx.Unlock()
+		atomic.AddUint64(&c.deduplicated, 1)
+		if retry, version, err := c.wait(ctx, call, model); !retry {
+			return version, err
+		}
+	}
+	call := &coalescedCall{done: make(chan struct{}), model: model}
+	calls[k] = call
+	c.mx.Unlock()
+
+	atomic.AddUint64(&c.backend, 1)
+	call.version, call.err = fetch()
+
+	c.mx.Lock()
+	delete(calls, k)
+	c.mx.Unlock()
+	close(call.done)
+	// followers copy from our caller's model, so it must not be handed back
+	// until they are done with it
+	call.followers.Wait()
+	return call.version, call.err
+}
+
+// wait copies the result of call into model. retry is true when the call was
+// cut short by its caller's ctx rather than ours.
+func (c *Coalesced) wait(ctx context.Context, call *coalescedCall, model model.Model) (retry bool, version string, err error) {
+	defer call.followers.Done()
+	select {
+	case <-call.done:
+	case <-ctx.Done():
+		return false, "", ctx.Err()
+	}
+	switch call.err {
+	case nil:
+		return false, call.version, model.Set(call.model)
+	case context.Canceled, context.DeadlineExceeded:
+		return ctx.Err() == nil, "", call.err
+	default:
+		return false, "", call.err
+	}
+}
+
+func (c *Coalesced) SaveIfVersion(key model.Key, model model.Model, version string) (string, error) {
+	return c.SaveIfVersionContext(context.Background(), key, model, version)
+}
+
+func (c *Coalesced) SaveIfVersionContext(ctx context.Context, key model.Key, model model.Model, version string) (string, error) {
+	v, ok := c.db.(VersionedDB)
+	if !ok {
+		return "", errNotVersioned
+	}
+	return v.SaveIfVersionContext(ctx, key, model, version)
+}
+
+func (c *Coalesced) DeleteIfVersion(key model.Key, version string) error {
+	return c.DeleteIfVersionContext(context.Background(), key, version)
+}
+
+func (c *Coalesced) DeleteIfVersionContext(ctx context.Context, key model.Key, version string) error {
+	v, ok := c.db.(VersionedDB)
+	if !ok {
+		return errNotVersioned
+	}
+	return v.DeleteIfVersionContext(ctx, key, version)
+}
+
+func (c *Coalesced) Scan(prefix, cursor string, limit int) ([]string, string, error) {
+	s, ok := c.db.(Scanner)
+	if !ok {
+		return nil, "", errNotScanner
+	}
+	return s.Scan(prefix, cursor, limit)
+}
+
+func (c *Coalesced) SaveMany(keys []model.Key, models []model.Model) error {
+	return WithBatch(c.db).SaveMany(keys, models)
+}
+
+func (c *Coalesced) GetMany(keys []model.Key, models []model.Model) error {
+	return WithBatch(c.db).GetMany(keys, models)
+}
+
+func (c *Coalesced) DeleteMany(keys []model.Key) error {
+	return WithBatch(c.db).DeleteMany(keys)
+}
+
+func (c *Coalesced) Stats() CoalescedStats {
+	return CoalescedStats{
+		Backend:      atomic.LoadUint64(&c.backend),
+		Deduplicated: atomic.LoadUint64(&c.deduplicated),
+	}
+}
+
+// WritePrometheus writes Stats in the Prometheus text exposition format.
+func (c *Coalesced) WritePrometheus(w io.Writer) error {
+	s := c.Stats()
+	_, err := fmt.Fprintf(w, `# HELP db_coalesced_gets_total Gets that reached the backend or shared another caller's call.
+# TYPE db_coalesced_gets_total counter
+db_coalesced_gets_total{result="backend"} %d
+db_coalesced_gets_total{result="deduplicated"} %d
+`, s.Backend, s.Deduplicated)
+	return err
+}
@@ -0,0 +1,124 @@
+package db
+
+import (
+	"bytes"
+	"context"
+	"github.com/llitfkitfk/GoHighPerformance/pkg/model"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// blockingDB holds every Get until release is closed.
+type blockingDB struct {
+	DB
+	entered chan struct{}
+	release chan struct{}
+}
+
+func (b *blockingDB) Get(key model.Key, model model.Model) error {
+	b.entered <- struct{}{}
+	<-b.release
+	return b.DB.Get(key, model)
+}
+
+func TestCoalescedGet(t *testing.T) {
+	const n = 10
+	backend := &blockingDB{DB: NewMem(), entered: make(chan struct{}, n), release: make(chan struct{})}
+	backend.DB.Save(testKey("hot"), &testModel{Val: "v"})
+	c := NewCoalesced(backend)
+
+	var wg sync.WaitGroup
+	results := make([]testModel, n)
+	errs := make([]error, n)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		errs[0] = c.Get(testKey("hot"), &results[0])
+	}()
+	<-backend.entered
+
+	for i := 1; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = c.Get(testKey("hot"), &results[i])
+		}(i)
+	}
+	// wait for every follower to join the in-flight call
+	for c.Stats().Deduplicated < n-1 {
+		runtime.Gosched()
+	}
+	close(backend.release)
+	wg.Wait()
+
+	for i := range results {
+		if errs[i] != nil || results[i].Val != "v" {
+			t.Fatalf("Get %d = %q, %v; want %q, nil", i, results[i].Val, errs[i], "v")
+		}
+	}
+	if s := c.Stats(); s.Backend != 1 || s.Deduplicated != n-1 {
+		t.Fatalf("Stats = %+v, want 1 backend call and %d deduplicated", s, n-1)
+	}
+}
+
+// ctxBlockingDB holds every GetContext until release is closed or ctx is done.
+type ctxBlockingDB struct {
+	DB
+	ContextDB
+	entered chan struct{}
+	release chan struct{}
+}
+
+func (b *ctxBlockingDB) GetContext(ctx context.Context, key model.Key, model model.Model) error {
+	b.entered <- struct{}{}
+	select {
+	case <-b.release:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	return b.ContextDB.GetContext(ctx, key, model)
+}
+
+func TestCoalescedContext(t *testing.T) {
+	m := NewMem()
+	m.Save(testKey("hot"), &testModel{Val: "v"})
+	backend := &ctxBlockingDB{DB: m, ContextDB: WithContext(m), entered: make(chan struct{}, 2), release: make(chan struct{})}
+	c := NewCoalesced(backend)
+
+	leaderCtx, cancelLeader := context.WithCancel(context.Background())
+	leaderErr := make(chan error)
+	go func() { leaderErr <- c.GetContext(leaderCtx, testKey("hot"), &testModel{}) }()
+	<-backend.entered
+
+	// a follower stops waiting when its own ctx ends
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := c.GetContext(ctx, testKey("hot"), &testModel{}); err != context.Canceled {
+		t.Fatalf("GetContext with canceled ctx = %v, want context.Canceled", err)
+	}
+
+	// but not when the leader's does; it makes its own call instead
+	var got testModel
+	followerErr := make(chan error)
+	go func() { followerErr <- c.GetContext(context.Background(), testKey("hot"), &got) }()
+	for c.Stats().Deduplicated < 2 {
+		runtime.Gosched()
+	}
+	cancelLeader()
+	if err := <-leaderErr; err != context.Canceled {
+		t.Fatalf("leader GetContext = %v, want context.Canceled", err)
+	}
+	<-backend.entered
+	close(backend.release)
+	if err := <-followerErr; err != nil || got.Val != "v" {
+		t.Fatalf("follower GetContext = %q, %v; want %q, nil", got.Val, err, "v")
+	}
+
+	var buf bytes.Buffer
+	c.WritePrometheus(&buf)
+	if want := `db_coalesced_gets_total{result="backend"} 2`; !strings.Contains(buf.String(), want) {
+		t.Fatalf("WritePrometheus output lacks %q:\n%s", want, buf.String())
+	}
+}
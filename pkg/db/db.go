@@ -1,6 +1,11 @@
 package db
 
-import "github.com/llitfkitfk/GoHighPerformance/pkg/model"
+import (
+	"context"
+	"errors"
+	"github.com/llitfkitfk/GoHighPerformance/pkg/model"
+	"time"
+)
 
 type DB interface {
 
@@ -9,4 +14,142 @@ type DB interface {
 	Delete(model.Key) error
 
 	Get(model.Key, model.Model) error
-}
\ No newline at end of file
+}
+
+// TTLDB is implemented by backends whose entries can expire. Get on an expired
+// key returns ErrNotFound.
+type TTLDB interface {
+	SaveWithTTL(model.Key, model.Model, time.Duration) error
+}
+
+// ContextDB is the context-aware variant of DB. Implementations should return
+// ctx.Err() once the context is cancelled or its deadline expires.
+type ContextDB interface {
+	SaveContext(context.Context, model.Key, model.Model) error
+
+	DeleteContext(context.Context, model.Key) error
+
+	GetContext(context.Context, model.Key, model.Model) error
+}
+
+// WithContext returns a ContextDB for db. If db already implements ContextDB it
+// is returned as is, otherwise the context is only checked before each call.
+func WithContext(db DB) ContextDB {
+	if cdb, ok := db.(ContextDB); ok {
+		return cdb
+	}
+	return contextDB{db: db}
+}
+
+// WithoutContext returns a DB that calls cdb with context.Background().
+func WithoutContext(cdb ContextDB) DB {
+	if db, ok := cdb.(DB); ok {
+		return db
+	}
+	return plainDB{cdb: cdb}
+}
+
+type contextDB struct {
+	db DB
+}
+
+func (c contextDB) SaveContext(ctx context.Context, key model.Key, model model.Model) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return c.db.Save(key, model)
+}
+
+func (c contextDB) DeleteContext(ctx context.Context, key model.Key) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return c.db.Delete(key)
+}
+
+func (c contextDB) GetContext(ctx context.Context, key model.Key, model model.Model) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return c.db.Get(key, model)
+}
+
+type plainDB struct {
+	cdb ContextDB
+}
+
+func (p plainDB) Save(key model.Key, model model.Model) error {
+	return p.cdb.SaveContext(context.Background(), key, model)
+}
+
+func (p plainDB) Delete(key model.Key) error {
+	return p.cdb.DeleteContext(context.Background(), key)
+}
+
+func (p plainDB) Get(key model.Key, model model.Model) error {
+	return p.cdb.GetContext(context.Background(), key, model)
+}
+
+// Pinger is implemented by backends that depend on a remote server.
+type Pinger interface {
+	Ping(context.Context) error
+}
+
+// Ping checks that db can serve requests. Backends that do not implement
+// Pinger, such as Mem, are always considered reachable.
+func Ping(ctx context.Context, db DB) error {
+	if p, ok := db.(Pinger); ok {
+		return p.Ping(ctx)
+	}
+	return ctx.Err()
+}
+
+// Wrapper is implemented by DBs that decorate another DB, such as Instrumented
+// and Coalesced. Decorators implement the optional interfaces themselves and
+// forward them, so Versioned and Scannable can tell whether the DB at the
+// bottom really supports them.
+type Wrapper interface {
+	Unwrap() DB
+}
+
+// Versioned returns db as a VersionedDB if db and every DB it wraps implement
+// VersionedDB.
+func Versioned(db DB) (VersionedDB, bool) {
+	v, ok := db.(VersionedDB)
+	if !ok {
+		return nil, false
+	}
+	if inner := unwrap(db); inner != nil {
+		if _, ok := Versioned(inner); !ok {
+			return nil, false
+		}
+	}
+	return v, true
+}
+
+// Scannable returns db as a Scanner if db and every DB it wraps implement
+// Scanner.
+func Scannable(db DB) (Scanner, bool) {
+	s, ok := db.(Scanner)
+	if !ok {
+		return nil, false
+	}
+	if inner := unwrap(db); inner != nil {
+		if _, ok := Scannable(inner); !ok {
+			return nil, false
+		}
+	}
+	return s, true
+}
+
+func unwrap(db DB) DB {
+	if w, ok := db.(Wrapper); ok {
+		return w.Unwrap()
+	}
+	return nil
+}
+
+var (
+	errNotVersioned = errors.New("db does not support versions")
+	errNotScanner   = errors.New("db does not support scanning")
+)
@@ -0,0 +1,58 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"github.com/llitfkitfk/GoHighPerformance/pkg/model"
+	"testing"
+)
+
+type testKey string
+
+func (k testKey) String() string {
+	return string(k)
+}
+
+type testModel struct {
+	Val string
+}
+
+func (t *testModel) MarshalBinary() ([]byte, error) {
+	return []byte(t.Val), nil
+}
+
+func (t *testModel) UnmarshalBinary(b []byte) error {
+	t.Val = string(b)
+	return nil
+}
+
+func (t *testModel) Set(m model.Model) error {
+	o, ok := m.(*testModel)
+	if !ok {
+		return errors.New("not a *testModel")
+	}
+	t.Val = o.Val
+	return nil
+}
+
+func TestContextAdapters(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	cdb := WithContext(plainDB{cdb: NewMem()})
+	if _, ok := cdb.(contextDB); !ok {
+		t.Fatalf("WithContext(plainDB) = %T, want contextDB", cdb)
+	}
+	if err := cdb.SaveContext(ctx, testKey("a"), &testModel{Val: "x"}); err != context.Canceled {
+		t.Fatalf("SaveContext with cancelled ctx = %v, want context.Canceled", err)
+	}
+
+	d := WithoutContext(cdb)
+	if err := d.Save(testKey("a"), &testModel{Val: "x"}); err != nil {
+		t.Fatalf("Save: %s", err)
+	}
+	var m testModel
+	if err := d.Get(testKey("a"), &m); err != nil || m.Val != "x" {
+		t.Fatalf("Get = %q, %v; want %q, nil", m.Val, err, "x")
+	}
+}
@@ -0,0 +1,393 @@
+package db
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/llitfkitfk/GoHighPerformance/pkg/model"
+	"hash/crc32"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// SyncPolicy controls when Disk fsyncs its log.
+type SyncPolicy string
+
+const (
+	SyncAlways   SyncPolicy = "always"   // after every write
+	SyncInterval SyncPolicy = "interval" // every DiskOptions.SyncInterval
+	SyncNever    SyncPolicy = "never"    // leave it to the OS
+)
+
+type DiskOptions struct {
+	Sync         SyncPolicy
+	SyncInterval time.Duration
+
+	// CompactInterval is how often Disk checks whether to compact; 0 disables
+	// background compaction. It compacts once stale records make up at least
+	// CompactRatio of the log.
+	CompactInterval time.Duration
+	CompactRatio    float64
+}
+
+const diskLog = "data.log"
+
+// Every record is a header followed by the key and the value. The first
+// checksum covers everything after itself, so a torn or corrupt record is
+// detected on open. The second covers just op and the lengths, so they can be
+// trusted to find where the record ends before the rest of it is read.
+//
+//	crc32c(4) header crc32c(4) op(1) key length(4) value length(4) key value
+const recordHeader = 17
+
+const (
+	opPut    byte = 1
+	opDelete byte = 2
+)
+
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+// ErrCorruptLog is returned by OpenDisk when a record header fails its
+// checksum, or a record before the last one does. Truncating there would
+// silently drop every later write, so the log is left for an operator to
+// inspect.
+var ErrCorruptLog = errors.New("corrupt log record")
+
+// Disk is an append-only log of MarshalBinary payloads with an in-memory index
+// of where each key's latest value lives.
+type Disk struct {
+	mx      sync.RWMutex
+	path    string
+	f       *os.File
+	opts    DiskOptions
+	index   map[string]diskEntry
+	size    int64 // end of the last good record
+	garbage int64 // bytes taken by overwritten and deleted records
+
+	stop      chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
+	closeErr  error
+}
+
+type diskEntry struct {
+	off  int64 // start of the record
+	klen uint32
+	vlen uint32
+}
+
+func (e diskEntry) valueOff() int64 {
+	return e.off + recordHeader + int64(e.klen)
+}
+
+func (e diskEntry) len() int64 {
+	return recordHeader + int64(e.klen) + int64(e.vlen)
+}
+
+// OpenDisk opens or creates the log in dir, replaying it to rebuild the index.
+// A torn record at the tail, left by a crash mid-write, is truncated; a corrupt
+// record anywhere else fails with ErrCorruptLog.
+func OpenDisk(dir string, opts DiskOptions) (*Disk, error) {
+	switch opts.Sync {
+	case SyncAlways, SyncNever:
+	case SyncInterval:
+		if opts.SyncInterval <= 0 {
+			return nil, fmt.Errorf("sync policy %q needs a positive sync interval", opts.Sync)
+		}
+	default:
+		return nil, fmt.Errorf("unknown sync policy %q", opts.Sync)
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	d := &Disk{
+		path:  filepath.Join(dir, diskLog),
+		opts:  opts,
+		index: make(map[string]diskEntry),
+		stop:  make(chan struct{}),
+		done:  make(chan struct{}),
+	}
+	f, err := os.OpenFile(d.path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	d.f = f
+	if err := d.replay(); err != nil {
+		f.Close()
+		return nil, err
+	}
+	go d.background()
+	return d, nil
+}
+
+func (d *Disk) replay() error {
+	fi, err := d.f.Stat()
+	if err != nil {
+		return err
+	}
+	r := bufio.NewReader(io.NewSectionReader(d.f, 0, fi.Size()))
+	hdr := make([]byte, recordHeader)
+	var off int64
+	for {
+		if _, err := io.ReadFull(r, hdr); err != nil {
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				break
+			}
+			return err
+		}
+		if crc32.Checksum(hdr[8:], crcTable) != binary.BigEndian.Uint32(hdr[4:]) {
+			return ErrCorruptLog
+		}
+		e := diskEntry{
+			off:  off,
+			klen: binary.BigEndian.Uint32(hdr[9:]),
+			vlen: binary.BigEndian.Uint32(hdr[13:]),
+		}
+		if off+e.len() > fi.Size() {
+			// the last record, cut short by a crash
+			break
+		}
+		body := make([]byte, int(e.klen)+int(e.vlen))
+		if _, err := io.ReadFull(r, body); err != nil {
+			return err
+		}
+		crc := crc32.Update(crc32.Checksum(hdr[4:], crcTable), crcTable, body)
+		if crc != binary.BigEndian.Uint32(hdr) {
+			if off+e.len() < fi.Size() {
+				return ErrCorruptLog
+			}
+			// the last record, torn by a crash
+			break
+		}
+
+		key := string(body[:e.klen])
+		if old, ok := d.index[key]; ok {
+			d.garbage += old.len()
+			delete(d.index, key)
+		}
+		switch hdr[8] {
+		case opPut:
+			d.index[key] = e
+		case opDelete:
+			d.garbage += e.len()
+		}
+		off += e.len()
+	}
+
+	if off < fi.Size() {
+		if err := d.f.Truncate(off); err != nil {
+			return err
+		}
+	}
+	d.size = off
+	return nil
+}
+
+func encodeRecord(op byte, key string, val []byte) []byte {
+	b := make([]byte, recordHeader+len(key)+len(val))
+	b[8] = op
+	binary.BigEndian.PutUint32(b[9:], uint32(len(key)))
+	binary.BigEndian.PutUint32(b[13:], uint32(len(val)))
+	binary.BigEndian.PutUint32(b[4:], crc32.Checksum(b[8:recordHeader], crcTable))
+	copy(b[recordHeader:], key)
+	copy(b[recordHeader+len(key):], val)
+	binary.BigEndian.PutUint32(b, crc32.Checksum(b[4:], crcTable))
+	return b
+}
+
+// write appends rec to the log. The caller must hold d.mx for writing.
+func (d *Disk) write(rec []byte) (int64, error) {
+	off := d.size
+	if _, err := d.f.Write(rec); err != nil {
+		// drop whatever part of rec made it so the next record starts at d.size
+		d.f.Truncate(d.size)
+		return 0, err
+	}
+	if d.opts.Sync == SyncAlways {
+		if err := d.f.Sync(); err != nil {
+			// the caller will not index rec, so take it back out of the log
+			d.f.Truncate(d.size)
+			return 0, err
+		}
+	}
+	d.size += int64(len(rec))
+	return off, nil
+}
+
+func (d *Disk) Save(key model.Key, model model.Model) error {
+	val, err := model.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	k := key.String()
+	rec := encodeRecord(opPut, k, val)
+
+	d.mx.Lock()
+	defer d.mx.Unlock()
+	off, err := d.write(rec)
+	if err != nil {
+		return err
+	}
+	if old, ok := d.index[k]; ok {
+		d.garbage += old.len()
+	}
+	d.index[k] = diskEntry{off: off, klen: uint32(len(k)), vlen: uint32(len(val))}
+	return nil
+}
+
+func (d *Disk) Delete(key model.Key) error {
+	k := key.String()
+	d.mx.Lock()
+	defer d.mx.Unlock()
+	old, ok := d.index[k]
+	if !ok {
+		return nil
+	}
+	rec := encodeRecord(opDelete, k, nil)
+	if _, err := d.write(rec); err != nil {
+		return err
+	}
+	delete(d.index, k)
+	d.garbage += old.len() + int64(len(rec))
+	return nil
+}
+
+func (d *Disk) Get(key model.Key, model model.Model) error {
+	d.mx.RLock()
+	e, ok := d.index[key.String()]
+	if !ok {
+		d.mx.RUnlock()
+		return ErrNotFound
+	}
+	val := make([]byte, e.vlen)
+	_, err := d.f.ReadAt(val, e.valueOff())
+	d.mx.RUnlock()
+	if err != nil {
+		return err
+	}
+	return model.UnmarshalBinary(val)
+}
+
+// Compact rewrites the log with only the live value of each key.
+func (d *Disk) Compact() error {
+	d.mx.Lock()
+	defer d.mx.Unlock()
+
+	tmpPath := d.path + ".compact"
+	tmp, err := os.OpenFile(tmpPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmpPath)
+	defer tmp.Close()
+
+	w := bufio.NewWriter(tmp)
+	index := make(map[string]diskEntry, len(d.index))
+	var off int64
+	for k, e := range d.index {
+		val := make([]byte, e.vlen)
+		if _, err := d.f.ReadAt(val, e.valueOff()); err != nil {
+			return err
+		}
+		rec := encodeRecord(opPut, k, val)
+		if _, err := w.Write(rec); err != nil {
+			return err
+		}
+		index[k] = diskEntry{off: off, klen: e.klen, vlen: e.vlen}
+		off += int64(len(rec))
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmpPath, d.path); err != nil {
+		return err
+	}
+	syncDir(filepath.Dir(d.path))
+
+	f, err := os.OpenFile(d.path, os.O_RDWR|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	d.f.Close()
+	d.f = f
+	d.index = index
+	d.size = off
+	d.garbage = 0
+	return nil
+}
+
+// syncDir makes a rename in dir durable. Not every platform supports it, so
+// errors are ignored.
+func syncDir(dir string) {
+	if f, err := os.Open(dir); err == nil {
+		f.Sync()
+		f.Close()
+	}
+}
+
+func (d *Disk) needsCompaction() bool {
+	d.mx.RLock()
+	defer d.mx.RUnlock()
+	return d.size > 0 && float64(d.garbage) >= d.opts.CompactRatio*float64(d.size)
+}
+
+func (d *Disk) background() {
+	defer close(d.done)
+	var syncC, compactC <-chan time.Time
+	if d.opts.Sync == SyncInterval {
+		t := time.NewTicker(d.opts.SyncInterval)
+		defer t.Stop()
+		syncC = t.C
+	}
+	if d.opts.CompactInterval > 0 {
+		t := time.NewTicker(d.opts.CompactInterval)
+		defer t.Stop()
+		compactC = t.C
+	}
+	for {
+		select {
+		case <-syncC:
+			d.mx.RLock()
+			err := d.f.Sync()
+			d.mx.RUnlock()
+			if err != nil {
+				log.Printf("Error syncing %s [%s]", d.path, err)
+			}
+		case <-compactC:
+			if !d.needsCompaction() {
+				continue
+			}
+			if err := d.Compact(); err != nil {
+				log.Printf("Error compacting %s [%s]", d.path, err)
+			}
+		case <-d.stop:
+			return
+		}
+	}
+}
+
+// Close stops background work, syncs the log and closes it. Later calls
+// return the first call's result.
+func (d *Disk) Close() error {
+	d.closeOnce.Do(func() {
+		close(d.stop)
+		<-d.done
+		d.mx.Lock()
+		defer d.mx.Unlock()
+		if d.closeErr = d.f.Sync(); d.closeErr != nil {
+			d.f.Close()
+			return
+		}
+		d.closeErr = d.f.Close()
+	})
+	return d.closeErr
+}
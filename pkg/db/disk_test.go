@@ -0,0 +1,149 @@
+package db
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func openTestDisk(t *testing.T, dir string) *Disk {
+	d, err := OpenDisk(dir, DiskOptions{Sync: SyncNever})
+	if err != nil {
+		t.Fatalf("OpenDisk: %s", err)
+	}
+	return d
+}
+
+func TestDiskPersists(t *testing.T) {
+	dir := t.TempDir()
+	d := openTestDisk(t, dir)
+	d.Save(testKey("a"), &testModel{Val: "1"})
+	d.Save(testKey("b"), &testModel{Val: "2"})
+	d.Save(testKey("a"), &testModel{Val: "3"})
+	d.Delete(testKey("b"))
+	if err := d.Close(); err != nil {
+		t.Fatalf("Close: %s", err)
+	}
+
+	d = openTestDisk(t, dir)
+	defer d.Close()
+	var m testModel
+	if err := d.Get(testKey("a"), &m); err != nil || m.Val != "3" {
+		t.Fatalf("Get(a) = %q, %v; want %q, nil", m.Val, err, "3")
+	}
+	if err := d.Get(testKey("b"), &m); err != ErrNotFound {
+		t.Fatalf("Get(b) = %v, want ErrNotFound", err)
+	}
+}
+
+func TestDiskTruncatesTornTail(t *testing.T) {
+	dir := t.TempDir()
+	d := openTestDisk(t, dir)
+	d.Save(testKey("a"), &testModel{Val: "1"})
+	d.Save(testKey("b"), &testModel{Val: "2"})
+	d.Close()
+
+	path := filepath.Join(dir, diskLog)
+	fi, _ := os.Stat(path)
+	good := int64(recordHeader + 2) // the record for a
+	if err := os.Truncate(path, fi.Size()-1); err != nil {
+		t.Fatal(err)
+	}
+
+	d = openTestDisk(t, dir)
+	var m testModel
+	if err := d.Get(testKey("a"), &m); err != nil || m.Val != "1" {
+		t.Fatalf("Get(a) = %q, %v; want %q, nil", m.Val, err, "1")
+	}
+	if err := d.Get(testKey("b"), &m); err != ErrNotFound {
+		t.Fatalf("Get(b) = %v, want ErrNotFound", err)
+	}
+	if fi, _ := os.Stat(path); fi.Size() != good {
+		t.Fatalf("log size = %d, want %d", fi.Size(), good)
+	}
+
+	// writes after recovery must be readable on the next open
+	d.Save(testKey("c"), &testModel{Val: "4"})
+	d.Close()
+	d = openTestDisk(t, dir)
+	defer d.Close()
+	if err := d.Get(testKey("c"), &m); err != nil || m.Val != "4" {
+		t.Fatalf("Get(c) = %q, %v; want %q, nil", m.Val, err, "4")
+	}
+}
+
+func TestDiskRejectsCorruptMiddle(t *testing.T) {
+	dir := t.TempDir()
+	d := openTestDisk(t, dir)
+	d.Save(testKey("a"), &testModel{Val: "1"})
+	d.Save(testKey("b"), &testModel{Val: "2"})
+	d.Close()
+	if err := d.Close(); err != nil {
+		t.Fatalf("second Close: %s", err)
+	}
+
+	// flip a byte of a's value; b's record after it is intact
+	path := filepath.Join(dir, diskLog)
+	data, _ := os.ReadFile(path)
+	data[recordHeader+1] ^= 0xff
+	os.WriteFile(path, data, 0644)
+
+	if _, err := OpenDisk(dir, DiskOptions{Sync: SyncNever}); err != ErrCorruptLog {
+		t.Fatalf("OpenDisk = %v, want ErrCorruptLog", err)
+	}
+	if fi, _ := os.Stat(path); fi.Size() != int64(len(data)) {
+		t.Fatalf("log truncated to %d bytes, want it left at %d", fi.Size(), len(data))
+	}
+}
+
+func TestDiskRejectsCorruptLength(t *testing.T) {
+	dir := t.TempDir()
+	d := openTestDisk(t, dir)
+	d.Save(testKey("a"), &testModel{Val: "1"})
+	d.Save(testKey("b"), &testModel{Val: "2"})
+	d.Save(testKey("c"), &testModel{Val: "3"})
+	d.Close()
+
+	// flip a's value length so its record seems to run past the end of the log
+	path := filepath.Join(dir, diskLog)
+	data, _ := os.ReadFile(path)
+	data[recordHeader-4] ^= 0xff
+	os.WriteFile(path, data, 0644)
+
+	if _, err := OpenDisk(dir, DiskOptions{Sync: SyncNever}); err != ErrCorruptLog {
+		t.Fatalf("OpenDisk = %v, want ErrCorruptLog", err)
+	}
+	if fi, _ := os.Stat(path); fi.Size() != int64(len(data)) {
+		t.Fatalf("log truncated to %d bytes, want it left at %d", fi.Size(), len(data))
+	}
+}
+
+func TestDiskCompact(t *testing.T) {
+	dir := t.TempDir()
+	d := openTestDisk(t, dir)
+	defer d.Close()
+	for i := 0; i < 10; i++ {
+		d.Save(testKey("a"), &testModel{Val: "v"})
+	}
+	d.Save(testKey("b"), &testModel{Val: "w"})
+	d.Delete(testKey("b"))
+	if !d.needsCompaction() {
+		t.Fatal("needsCompaction = false with mostly stale log")
+	}
+
+	if err := d.Compact(); err != nil {
+		t.Fatalf("Compact: %s", err)
+	}
+	fi, _ := os.Stat(filepath.Join(dir, diskLog))
+	if want := int64(recordHeader + 2); fi.Size() != want {
+		t.Fatalf("compacted size = %d, want %d", fi.Size(), want)
+	}
+	var m testModel
+	if err := d.Get(testKey("a"), &m); err != nil || m.Val != "v" {
+		t.Fatalf("Get(a) = %q, %v; want %q, nil", m.Val, err, "v")
+	}
+	d.Save(testKey("c"), &testModel{Val: "x"})
+	if err := d.Get(testKey("c"), &m); err != nil || m.Val != "x" {
+		t.Fatalf("Get(c) after compaction = %q, %v; want %q, nil", m.Val, err, "x")
+	}
+}
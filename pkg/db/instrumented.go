@@ -0,0 +1,232 @@
+package db
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"github.com/llitfkitfk/GoHighPerformance/pkg/model"
+	"io"
+	"sort"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// latencyBuckets are the upper bounds, in seconds, of the latency histogram.
+var latencyBuckets = [...]float64{.0001, .00025, .0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5}
+
+const (
+	metricSave = iota
+	metricGet
+	metricDelete
+	metricScan
+	metricSaveMany
+	metricGetMany
+	metricDeleteMany
+	numMetricOps
+)
+
+var metricOpNames = [numMetricOps]string{"save", "get", "delete", "scan", "save_many", "get_many", "delete_many"}
+
+type opMetrics struct {
+	buckets  [len(latencyBuckets) + 1]uint64 // per bucket counts, the last one is +Inf
+	count    uint64
+	nanos    uint64
+	notFound uint64
+	errors   uint64
+	inFlight int64
+}
+
+// Instrumented wraps a DB and records, per operation, a latency histogram,
+// error counts split into ErrNotFound and everything else, and the number of
+// calls in flight. WritePrometheus exposes them in the Prometheus text format.
+// The VersionedDB methods count as get, save and delete.
+type Instrumented struct {
+	db  DB
+	cdb ContextDB
+	ops [numMetricOps]opMetrics
+}
+
+func NewInstrumented(db DB) *Instrumented {
+	return &Instrumented{db: db, cdb: WithContext(db)}
+}
+
+// Unwrap returns the wrapped DB. Calls made through it are not recorded.
+func (i *Instrumented) Unwrap() DB {
+	return i.db
+}
+
+func (i *Instrumented) Save(key model.Key, model model.Model) error {
+	done := i.begin(metricSave)
+	err := i.db.Save(key, model)
+	done(err)
+	return err
+}
+
+func (i *Instrumented) Delete(key model.Key) error {
+	done := i.begin(metricDelete)
+	err := i.db.Delete(key)
+	done(err)
+	return err
+}
+
+func (i *Instrumented) Get(key model.Key, model model.Model) error {
+	done := i.begin(metricGet)
+	err := i.db.Get(key, model)
+	done(err)
+	return err
+}
+
+func (i *Instrumented) SaveContext(ctx context.Context, key model.Key, model model.Model) error {
+	done := i.begin(metricSave)
+	err := i.cdb.SaveContext(ctx, key, model)
+	done(err)
+	return err
+}
+
+func (i *Instrumented) DeleteContext(ctx context.Context, key model.Key) error {
+	done := i.begin(metricDelete)
+	err := i.cdb.DeleteContext(ctx, key)
+	done(err)
+	return err
+}
+
+func (i *Instrumented) GetContext(ctx context.Context, key model.Key, model model.Model) error {
+	done := i.begin(metricGet)
+	err := i.cdb.GetContext(ctx, key, model)
+	done(err)
+	return err
+}
+
+func (i *Instrumented) GetVersion(key model.Key, model model.Model) (string, error) {
+	return i.GetVersionContext(context.Background(), key, model)
+}
+
+func (i *Instrumented) GetVersionContext(ctx context.Context, key model.Key, model model.Model) (string, error) {
+	v, ok := i.db.(VersionedDB)
+	if !ok {
+		return "", errNotVersioned
+	}
+	done := i.begin(metricGet)
+	version, err := v.GetVersionContext(ctx, key, model)
+	done(err)
+	return version, err
+}
+
+func (i *Instrumented) SaveIfVersion(key model.Key, model model.Model, version string) (string, error) {
+	return i.SaveIfVersionContext(context.Background(), key, model, version)
+}
+
+func (i *Instrumented) SaveIfVersionContext(ctx context.Context, key model.Key, model model.Model, version string) (string, error) {
+	v, ok := i.db.(VersionedDB)
+	if !ok {
+		return "", errNotVersioned
+	}
+	done := i.begin(metricSave)
+	next, err := v.SaveIfVersionContext(ctx, key, model, version)
+	done(err)
+	return next, err
+}
+
+func (i *Instrumented) DeleteIfVersion(key model.Key, version string) error {
+	return i.DeleteIfVersionContext(context.Background(), key, version)
+}
+
+func (i *Instrumented) DeleteIfVersionContext(ctx context.Context, key model.Key, version string) error {
+	v, ok := i.db.(VersionedDB)
+	if !ok {
+		return errNotVersioned
+	}
+	done := i.begin(metricDelete)
+	err := v.DeleteIfVersionContext(ctx, key, version)
+	done(err)
+	return err
+}
+
+func (i *Instrumented) Scan(prefix, cursor string, limit int) ([]string, string, error) {
+	s, ok := i.db.(Scanner)
+	if !ok {
+		return nil, "", errNotScanner
+	}
+	done := i.begin(metricScan)
+	keys, next, err := s.Scan(prefix, cursor, limit)
+	done(err)
+	return keys, next, err
+}
+
+func (i *Instrumented) SaveMany(keys []model.Key, models []model.Model) error {
+	done := i.begin(metricSaveMany)
+	err := WithBatch(i.db).SaveMany(keys, models)
+	done(err)
+	return err
+}
+
+func (i *Instrumented) GetMany(keys []model.Key, models []model.Model) error {
+	done := i.begin(metricGetMany)
+	err := WithBatch(i.db).GetMany(keys, models)
+	done(err)
+	return err
+}
+
+func (i *Instrumented) DeleteMany(keys []model.Key) error {
+	done := i.begin(metricDeleteMany)
+	err := WithBatch(i.db).DeleteMany(keys)
+	done(err)
+	return err
+}
+
+// begin marks a call to op as in flight and returns the function that records
+// its latency and outcome.
+func (i *Instrumented) begin(op int) func(error) {
+	m := &i.ops[op]
+	atomic.AddInt64(&m.inFlight, 1)
+	start := time.Now()
+	return func(err error) {
+		d := time.Since(start)
+		atomic.AddUint64(&m.buckets[sort.SearchFloat64s(latencyBuckets[:], d.Seconds())], 1)
+		atomic.AddUint64(&m.count, 1)
+		atomic.AddUint64(&m.nanos, uint64(d))
+		switch {
+		case err == ErrNotFound:
+			atomic.AddUint64(&m.notFound, 1)
+		case err != nil:
+			atomic.AddUint64(&m.errors, 1)
+		}
+		atomic.AddInt64(&m.inFlight, -1)
+	}
+}
+
+// WritePrometheus writes the metrics in the Prometheus text exposition format.
+func (i *Instrumented) WritePrometheus(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+
+	fmt.Fprintln(bw, "# HELP db_operation_duration_seconds Latency of storage operations.")
+	fmt.Fprintln(bw, "# TYPE db_operation_duration_seconds histogram")
+	for op := range i.ops {
+		m := &i.ops[op]
+		var cum uint64
+		for b, le := range latencyBuckets {
+			cum += atomic.LoadUint64(&m.buckets[b])
+			fmt.Fprintf(bw, "db_operation_duration_seconds_bucket{op=%q,le=%q} %d\n", metricOpNames[op], strconv.FormatFloat(le, 'g', -1, 64), cum)
+		}
+		cum += atomic.LoadUint64(&m.buckets[len(latencyBuckets)])
+		fmt.Fprintf(bw, "db_operation_duration_seconds_bucket{op=%q,le=\"+Inf\"} %d\n", metricOpNames[op], cum)
+		fmt.Fprintf(bw, "db_operation_duration_seconds_sum{op=%q} %g\n", metricOpNames[op], float64(atomic.LoadUint64(&m.nanos))/1e9)
+		fmt.Fprintf(bw, "db_operation_duration_seconds_count{op=%q} %d\n", metricOpNames[op], atomic.LoadUint64(&m.count))
+	}
+
+	fmt.Fprintln(bw, "# HELP db_operation_errors_total Storage operations that returned an error.")
+	fmt.Fprintln(bw, "# TYPE db_operation_errors_total counter")
+	for op := range i.ops {
+		m := &i.ops[op]
+		fmt.Fprintf(bw, "db_operation_errors_total{op=%q,kind=\"not_found\"} %d\n", metricOpNames[op], atomic.LoadUint64(&m.notFound))
+		fmt.Fprintf(bw, "db_operation_errors_total{op=%q,kind=\"other\"} %d\n", metricOpNames[op], atomic.LoadUint64(&m.errors))
+	}
+
+	fmt.Fprintln(bw, "# HELP db_operations_in_flight Storage operations currently running.")
+	fmt.Fprintln(bw, "# TYPE db_operations_in_flight gauge")
+	for op := range i.ops {
+		fmt.Fprintf(bw, "db_operations_in_flight{op=%q} %d\n", metricOpNames[op], atomic.LoadInt64(&i.ops[op].inFlight))
+	}
+	return bw.Flush()
+}
@@ -0,0 +1,57 @@
+package db
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestInstrumented(t *testing.T) {
+	i := NewInstrumented(NewMem())
+	i.Save(testKey("a"), &testModel{Val: "1"})
+	var m testModel
+	i.Get(testKey("a"), &m)
+	i.Get(testKey("missing"), &m)
+
+	var buf bytes.Buffer
+	if err := i.WritePrometheus(&buf); err != nil {
+		t.Fatalf("WritePrometheus: %s", err)
+	}
+	out := buf.String()
+	for _, want := range []string{
+		`db_operation_duration_seconds_bucket{op="get",le="+Inf"} 2`,
+		`db_operation_duration_seconds_count{op="save"} 1`,
+		`db_operation_errors_total{op="get",kind="not_found"} 1`,
+		`db_operation_errors_total{op="get",kind="other"} 0`,
+		`db_operations_in_flight{op="delete"} 0`,
+	} {
+		if !strings.Contains(out, want+"\n") {
+			t.Errorf("output is missing %q", want)
+		}
+	}
+}
+
+func TestDecoratorCapabilities(t *testing.T) {
+	wrapped := NewInstrumented(NewCoalesced(NewMem()))
+	if v, ok := Versioned(wrapped); !ok || v != VersionedDB(wrapped) {
+		t.Fatalf("Versioned = %v, %v; want the Instrumented itself", v, ok)
+	}
+	if s, ok := Scannable(wrapped); !ok || s != Scanner(wrapped) {
+		t.Fatalf("Scannable = %v, %v; want the Instrumented itself", s, ok)
+	}
+	if b := WithBatch(wrapped); b != Batch(wrapped) {
+		t.Fatalf("WithBatch = %T, want the Instrumented itself", b)
+	}
+
+	// a DB at the bottom without the capabilities must not gain them
+	plain := NewInstrumented(NewCoalesced(struct{ DB }{NewMem()}))
+	if _, ok := Versioned(plain); ok {
+		t.Fatal("Versioned reported support the wrapped DB lacks")
+	}
+	if _, ok := Scannable(plain); ok {
+		t.Fatal("Scannable reported support the wrapped DB lacks")
+	}
+	if _, err := plain.GetVersion(testKey("a"), &testModel{}); err != errNotVersioned {
+		t.Fatalf("GetVersion = %v, want errNotVersioned", err)
+	}
+}
@@ -0,0 +1,252 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"github.com/llitfkitfk/GoHighPerformance/pkg/model"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// CacheMode selects how Layered propagates writes.
+type CacheMode string
+
+const (
+	// ReadThrough writes to the backing store only and invalidates the cache.
+	ReadThrough CacheMode = "read-through"
+	// WriteThrough writes to the backing store, then to the cache.
+	WriteThrough CacheMode = "write-through"
+	// WriteBehind writes to the cache and queues the backing store write.
+	WriteBehind CacheMode = "write-behind"
+)
+
+// Layered puts a cache DB (typically a Mem) in front of a backing DB
+// (typically a Redis). Gets are served from the cache and filled from the
+// backing store on a miss. Keys missing from the backing store are remembered
+// for negativeTTL so repeated misses do not reach it.
+type Layered struct {
+	cache, backing DB
+	mode           CacheMode
+	negativeTTL    time.Duration
+
+	mx       sync.Mutex
+	negative map[string]time.Time
+	pending  map[string]*layeredWrite // latest queued write per key
+	fills    map[string]*layeredFill  // keys being read from the backing store
+
+	queue  chan *layeredWrite
+	done   chan struct{}
+	failed uint64
+}
+
+type layeredWrite struct {
+	key    model.Key
+	model  model.Model // nil for a delete
+	delete bool
+}
+
+// layeredFill counts the Gets reading a key from the backing store and the
+// writes to the key since they started. A Get that raced a write may have read
+// the old value, so it must not put it, or its absence, into the cache.
+type layeredFill struct {
+	readers int
+	gen     uint64
+}
+
+// NewLayered returns a Layered over cache and backing. In WriteBehind mode up
+// to queueSize writes may wait for the backing store before Save blocks; Close
+// flushes them.
+func NewLayered(cache, backing DB, mode CacheMode, negativeTTL time.Duration, queueSize int) (*Layered, error) {
+	switch mode {
+	case ReadThrough, WriteThrough, WriteBehind:
+	default:
+		return nil, fmt.Errorf("unknown cache mode %q", mode)
+	}
+	l := &Layered{
+		cache:       cache,
+		backing:     backing,
+		mode:        mode,
+		negativeTTL: negativeTTL,
+		negative:    make(map[string]time.Time),
+		pending:     make(map[string]*layeredWrite),
+		fills:       make(map[string]*layeredFill),
+	}
+	if mode == WriteBehind {
+		l.queue = make(chan *layeredWrite, queueSize)
+		l.done = make(chan struct{})
+		go l.flush()
+	}
+	return l, nil
+}
+
+func (l *Layered) Save(key model.Key, model model.Model) error {
+	switch l.mode {
+	case ReadThrough:
+		if err := l.backing.Save(key, model); err != nil {
+			return err
+		}
+		l.invalidate(key.String())
+		return l.cache.Delete(key)
+	case WriteThrough:
+		if err := l.backing.Save(key, model); err != nil {
+			return err
+		}
+		l.invalidate(key.String())
+		return l.cache.Save(key, model)
+	default:
+		w := &layeredWrite{key: key, model: model}
+		l.stage(w)
+		if err := l.cache.Save(key, model); err != nil {
+			l.unstage(w)
+			return err
+		}
+		l.queue <- w
+		return nil
+	}
+}
+
+func (l *Layered) Delete(key model.Key) error {
+	if l.mode == WriteBehind {
+		w := &layeredWrite{key: key, delete: true}
+		l.stage(w)
+		if err := l.cache.Delete(key); err != nil {
+			l.unstage(w)
+			return err
+		}
+		l.queue <- w
+		return nil
+	}
+	if err := l.backing.Delete(key); err != nil {
+		return err
+	}
+	l.invalidate(key.String())
+	return l.cache.Delete(key)
+}
+
+// invalidate drops the negative entry for k and makes Gets already reading k
+// from the backing store skip the cache. Writers call it after the backing
+// store has the new value and before the cache does.
+func (l *Layered) invalidate(k string) {
+	l.mx.Lock()
+	l.invalidateLocked(k)
+	l.mx.Unlock()
+}
+
+func (l *Layered) invalidateLocked(k string) {
+	delete(l.negative, k)
+	if f, ok := l.fills[k]; ok {
+		f.gen++
+	}
+}
+
+func (l *Layered) Get(key model.Key, model model.Model) error {
+	if err := l.cache.Get(key, model); err == nil {
+		return nil
+	}
+
+	k := key.String()
+	l.mx.Lock()
+	if w, ok := l.pending[k]; ok {
+		// the backing store is behind; answer from the queued write
+		l.mx.Unlock()
+		if w.delete {
+			return ErrNotFound
+		}
+		return model.Set(w.model)
+	}
+	if exp, ok := l.negative[k]; ok {
+		if time.Now().Before(exp) {
+			l.mx.Unlock()
+			return ErrNotFound
+		}
+		delete(l.negative, k)
+	}
+	f, ok := l.fills[k]
+	if !ok {
+		f = &layeredFill{}
+		l.fills[k] = f
+	}
+	f.readers++
+	gen := f.gen
+	l.mx.Unlock()
+
+	err := l.backing.Get(key, model)
+
+	l.mx.Lock()
+	defer l.mx.Unlock()
+	if f.readers--; f.readers == 0 {
+		delete(l.fills, k)
+	}
+	if f.gen != gen {
+		return err
+	}
+	if err == ErrNotFound && l.negativeTTL > 0 {
+		l.negative[k] = time.Now().Add(l.negativeTTL)
+	}
+	if err != nil {
+		return err
+	}
+	return l.cache.Save(key, model)
+}
+
+// stage records w as the latest write to its key, for Get to answer from
+// until the backing store has it. It happens before the cache write so that a
+// concurrent fill cannot overwrite it.
+func (l *Layered) stage(w *layeredWrite) {
+	l.mx.Lock()
+	l.pending[w.key.String()] = w
+	l.invalidateLocked(w.key.String())
+	l.mx.Unlock()
+}
+
+// unstage forgets w unless a later write to its key replaced it.
+func (l *Layered) unstage(w *layeredWrite) {
+	l.mx.Lock()
+	if l.pending[w.key.String()] == w {
+		delete(l.pending, w.key.String())
+	}
+	l.mx.Unlock()
+}
+
+// flush applies queued writes to the backing store in order.
+func (l *Layered) flush() {
+	defer close(l.done)
+	for w := range l.queue {
+		var err error
+		if w.delete {
+			err = l.backing.Delete(w.key)
+		} else {
+			err = l.backing.Save(w.key, w.model)
+		}
+		if err != nil {
+			atomic.AddUint64(&l.failed, 1)
+			log.Printf("Error writing %s behind [%s]", w.key, err)
+		}
+		l.unstage(w)
+	}
+}
+
+// Ping checks both layers.
+func (l *Layered) Ping(ctx context.Context) error {
+	if err := Ping(ctx, l.cache); err != nil {
+		return err
+	}
+	return Ping(ctx, l.backing)
+}
+
+// FailedWrites returns how many write-behind writes the backing store rejected.
+func (l *Layered) FailedWrites() uint64 {
+	return atomic.LoadUint64(&l.failed)
+}
+
+// Close flushes queued write-behind writes. The Layered must not be used
+// afterwards.
+func (l *Layered) Close() error {
+	if l.queue != nil {
+		close(l.queue)
+		<-l.done
+	}
+	return nil
+}
@@ -0,0 +1,138 @@
+package db
+
+import (
+	"github.com/llitfkitfk/GoHighPerformance/pkg/model"
+	"testing"
+	"time"
+)
+
+// countingDB counts Gets that reach it.
+type countingDB struct {
+	DB
+	gets int
+}
+
+func (c *countingDB) Get(key model.Key, model model.Model) error {
+	c.gets++
+	return c.DB.Get(key, model)
+}
+
+func TestLayeredReadThrough(t *testing.T) {
+	cache, backing := NewMemCopy(), &countingDB{DB: NewMemCopy()}
+	l, _ := NewLayered(cache, backing, ReadThrough, time.Minute, 0)
+
+	backing.Save(testKey("a"), &testModel{Val: "1"})
+	var m testModel
+	for i := 0; i < 2; i++ {
+		if err := l.Get(testKey("a"), &m); err != nil || m.Val != "1" {
+			t.Fatalf("Get = %q, %v; want %q, nil", m.Val, err, "1")
+		}
+	}
+	if backing.gets != 1 {
+		t.Fatalf("backing Gets = %d, want 1", backing.gets)
+	}
+
+	// misses are cached too
+	for i := 0; i < 2; i++ {
+		if err := l.Get(testKey("missing"), &m); err != ErrNotFound {
+			t.Fatalf("Get(missing) = %v, want ErrNotFound", err)
+		}
+	}
+	if backing.gets != 2 {
+		t.Fatalf("backing Gets = %d, want 2", backing.gets)
+	}
+
+	// a save must not be hidden by the cached value or the cached miss
+	l.Save(testKey("a"), &testModel{Val: "2"})
+	l.Save(testKey("missing"), &testModel{Val: "3"})
+	if err := l.Get(testKey("a"), &m); err != nil || m.Val != "2" {
+		t.Fatalf("Get after Save = %q, %v; want %q, nil", m.Val, err, "2")
+	}
+	if err := l.Get(testKey("missing"), &m); err != nil || m.Val != "3" {
+		t.Fatalf("Get of negatively cached key after Save = %q, %v", m.Val, err)
+	}
+
+	l.Delete(testKey("a"))
+	if err := l.Get(testKey("a"), &m); err != ErrNotFound {
+		t.Fatalf("Get after Delete = %v, want ErrNotFound", err)
+	}
+}
+
+func TestLayeredWriteThrough(t *testing.T) {
+	cache, backing := NewMemCopy(), NewMemCopy()
+	l, _ := NewLayered(cache, backing, WriteThrough, 0, 0)
+
+	l.Save(testKey("a"), &testModel{Val: "1"})
+	var m testModel
+	if err := cache.Get(testKey("a"), &m); err != nil {
+		t.Fatalf("cache Get: %s", err)
+	}
+	if err := backing.Get(testKey("a"), &m); err != nil {
+		t.Fatalf("backing Get: %s", err)
+	}
+}
+
+func TestLayeredWriteBehind(t *testing.T) {
+	cache, backing := NewMemCopy(), NewMemCopy()
+	l, _ := NewLayered(cache, backing, WriteBehind, 0, 16)
+
+	l.Save(testKey("a"), &testModel{Val: "1"})
+	l.Save(testKey("b"), &testModel{Val: "2"})
+	l.Delete(testKey("b"))
+	cache.Delete(testKey("a")) // evicted from the cache before the flush
+
+	var m testModel
+	if err := l.Get(testKey("a"), &m); err != nil || m.Val != "1" {
+		t.Fatalf("Get = %q, %v; want %q, nil", m.Val, err, "1")
+	}
+	if err := l.Get(testKey("b"), &m); err != ErrNotFound {
+		t.Fatalf("Get(b) = %v, want ErrNotFound", err)
+	}
+
+	l.Close()
+	if err := backing.Get(testKey("a"), &m); err != nil || m.Val != "1" {
+		t.Fatalf("backing Get after Close = %q, %v", m.Val, err)
+	}
+	if err := backing.Get(testKey("b"), &m); err != ErrNotFound {
+		t.Fatalf("backing Get(b) after Close = %v, want ErrNotFound", err)
+	}
+}
+
+// racingDB runs write once, after its first Get has read the old value.
+type racingDB struct {
+	DB
+	write func()
+}
+
+func (r *racingDB) Get(key model.Key, model model.Model) error {
+	err := r.DB.Get(key, model)
+	if w := r.write; w != nil {
+		r.write = nil
+		w()
+	}
+	return err
+}
+
+func TestLayeredFillRacesWrite(t *testing.T) {
+	for _, mode := range []CacheMode{ReadThrough, WriteThrough, WriteBehind} {
+		backing := &racingDB{DB: NewMemCopy()}
+		l, _ := NewLayered(NewMemCopy(), backing, mode, time.Minute, 16)
+		backing.Save(testKey("a"), &testModel{Val: "1"})
+
+		// a Save lands while Get is filling a, and another while Get is
+		// caching that b is missing
+		var m testModel
+		backing.write = func() { l.Save(testKey("a"), &testModel{Val: "2"}) }
+		l.Get(testKey("a"), &m)
+		backing.write = func() { l.Save(testKey("b"), &testModel{Val: "3"}) }
+		l.Get(testKey("b"), &m)
+
+		if err := l.Get(testKey("a"), &m); err != nil || m.Val != "2" {
+			t.Errorf("%s: Get(a) = %q, %v; want %q, nil", mode, m.Val, err, "2")
+		}
+		if err := l.Get(testKey("b"), &m); err != nil || m.Val != "3" {
+			t.Errorf("%s: Get(b) = %q, %v; want %q, nil", mode, m.Val, err, "3")
+		}
+		l.Close()
+	}
+}
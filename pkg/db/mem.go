@@ -1,42 +1,458 @@
 package db
 
 import (
+	"context"
 	"errors"
 	"github.com/llitfkitfk/GoHighPerformance/pkg/model"
+	"sort"
+	"strings"
 	"sync"
+	"time"
 )
 
 var ErrNotFound = errors.New("not found")
 
 type Mem struct {
-	mx sync.RWMutex
-	m  map[string]model.Model
+	mx  sync.RWMutex
+	m   map[string]model.Model
+	exp map[string]time.Time // deadlines of keys saved with a TTL
+	now func() time.Time
+
+	// copy makes Save store MarshalBinary snapshots instead of the caller's
+	// model, so Mem behaves like a remote backend.
+	copy bool
+
+	feed feed
+
+	stop chan struct{}
+	done chan struct{}
 }
 
 func NewMem() *Mem {
-	return &Mem{m: make(map[string]model.Model)}
+	return &Mem{
+		m:   make(map[string]model.Model),
+		exp: make(map[string]time.Time),
+		now: time.Now,
+	}
+}
+
+// NewMemCopy returns a Mem that snapshots models through MarshalBinary on save
+// and restores them through UnmarshalBinary on get. Mutating a model after
+// saving it does not change what is stored, and serialization bugs surface in
+// tests instead of against Redis.
+func NewMemCopy() *Mem {
+	m := NewMem()
+	m.copy = true
+	return m
+}
+
+// store returns what Mem keeps for model: the model itself, or a snapshot of
+// its binary form in copy mode.
+func (m *Mem) store(model model.Model) (model.Model, error) {
+	if !m.copy {
+		return model, nil
+	}
+	b, err := model.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	s := snapshot(b)
+	return &s, nil
+}
+
+// load fills model from a value previously returned by store.
+func load(stored, model model.Model) error {
+	if s, ok := stored.(*snapshot); ok {
+		return model.UnmarshalBinary(*s)
+	}
+	return model.Set(stored)
 }
 
 func (m *Mem) Save(key model.Key, model model.Model) error {
+	md, err := m.store(model)
+	if err != nil {
+		return err
+	}
+	m.mx.Lock()
+	defer m.mx.Unlock()
+	m.m[key.String()] = md
+	delete(m.exp, key.String())
+	m.notify(OpSave, key.String(), md)
+	return nil
+}
+
+// SaveWithTTL saves model so that it expires after ttl. A ttl <= 0 never expires.
+func (m *Mem) SaveWithTTL(key model.Key, model model.Model, ttl time.Duration) error {
+	if ttl <= 0 {
+		return m.Save(key, model)
+	}
+	md, err := m.store(model)
+	if err != nil {
+		return err
+	}
 	m.mx.Lock()
 	defer m.mx.Unlock()
-	m.m[key.String()] = model
+	m.m[key.String()] = md
+	m.exp[key.String()] = m.now().Add(ttl)
+	m.notify(OpSave, key.String(), md)
 	return nil
 }
 
 func (m *Mem) Delete(key model.Key) error {
 	m.mx.Lock()
 	defer m.mx.Unlock()
-	delete(m.m, key.String())
+	m.delete(key.String())
 	return nil
 }
 
+// delete removes k and tells watchers if it existed. The caller must hold
+// m.mx for writing.
+func (m *Mem) delete(k string) {
+	if _, ok := m.m[k]; ok {
+		delete(m.m, k)
+		m.notify(OpDelete, k, nil)
+	}
+	delete(m.exp, k)
+}
+
+// notify publishes a write to watchers. It is called with m.mx held for
+// writing so events come out in the order the writes were applied.
+func (m *Mem) notify(op Op, k string, md model.Model) {
+	if !m.feed.active() {
+		return
+	}
+	ev := Event{Key: k, Op: op}
+	if md != nil {
+		ev.Value, _ = md.MarshalBinary()
+	}
+	m.feed.publish(ev)
+}
+
+// Watch implements Watcher. Each subscriber gets a buffered channel; events
+// that do not fit are dropped and counted by DroppedEvents.
+func (m *Mem) Watch(ctx context.Context, prefix string) (<-chan Event, error) {
+	return m.feed.subscribe(ctx, prefix), nil
+}
+
+// DroppedEvents returns how many events slow watchers have missed.
+func (m *Mem) DroppedEvents() uint64 {
+	return m.feed.Dropped()
+}
+
 func (m *Mem) Get(key model.Key, model model.Model) error {
+	k := key.String()
+	m.mx.RLock()
+	md, ok := m.m[k]
+	expired := ok && m.expired(k, m.now())
+	if ok && !expired {
+		defer m.mx.RUnlock()
+		return load(md, model)
+	}
+	m.mx.RUnlock()
+	if expired {
+		m.evict(k)
+	}
+	return ErrNotFound
+}
+
+// expired reports whether k has a deadline at or before now. The caller must
+// hold m.mx.
+func (m *Mem) expired(k string, now time.Time) bool {
+	d, ok := m.exp[k]
+	return ok && !now.Before(d)
+}
+
+// evict removes k if it is still expired once the write lock is held.
+func (m *Mem) evict(k string) {
+	m.mx.Lock()
+	defer m.mx.Unlock()
+	if m.expired(k, m.now()) {
+		delete(m.m, k)
+		delete(m.exp, k)
+	}
+}
+
+// DeleteExpired removes every expired key.
+func (m *Mem) DeleteExpired() {
+	m.mx.Lock()
+	defer m.mx.Unlock()
+	now := m.now()
+	for k, d := range m.exp {
+		if !now.Before(d) {
+			delete(m.m, k)
+			delete(m.exp, k)
+		}
+	}
+}
+
+// StartJanitor starts a goroutine that calls DeleteExpired every interval
+// until Close is called. Starting a second janitor is a no-op.
+func (m *Mem) StartJanitor(interval time.Duration) {
+	m.mx.Lock()
+	defer m.mx.Unlock()
+	if m.stop != nil {
+		return
+	}
+	m.stop = make(chan struct{})
+	m.done = make(chan struct{})
+	go m.janitor(interval, m.stop, m.done)
+}
+
+func (m *Mem) janitor(interval time.Duration, stop <-chan struct{}, done chan<- struct{}) {
+	defer close(done)
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+			m.DeleteExpired()
+		case <-stop:
+			return
+		}
+	}
+}
+
+// Close stops the janitor, if any, and waits for it to exit.
+func (m *Mem) Close() error {
+	m.mx.Lock()
+	stop, done := m.stop, m.done
+	m.stop, m.done = nil, nil
+	m.mx.Unlock()
+	if stop != nil {
+		close(stop)
+		<-done
+	}
+	return nil
+}
+
+func (m *Mem) SaveContext(ctx context.Context, key model.Key, model model.Model) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return m.Save(key, model)
+}
+
+func (m *Mem) DeleteContext(ctx context.Context, key model.Key) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return m.Delete(key)
+}
+
+func (m *Mem) GetContext(ctx context.Context, key model.Key, model model.Model) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return m.Get(key, model)
+}
+
+func (m *Mem) SaveMany(keys []model.Key, models []model.Model) error {
+	if len(keys) != len(models) {
+		return ErrBatchSize
+	}
+	errs := make([]error, len(keys))
+	stored := make([]model.Model, len(models))
+	for i, md := range models {
+		stored[i], errs[i] = m.store(md)
+	}
+	m.mx.Lock()
+	defer m.mx.Unlock()
+	for i, key := range keys {
+		if errs[i] != nil {
+			continue
+		}
+		m.m[key.String()] = stored[i]
+		delete(m.exp, key.String())
+		m.notify(OpSave, key.String(), stored[i])
+	}
+	return batchErr(errs)
+}
+
+func (m *Mem) GetMany(keys []model.Key, models []model.Model) error {
+	if len(keys) != len(models) {
+		return ErrBatchSize
+	}
+	errs := make([]error, len(keys))
+	m.mx.RLock()
+	defer m.mx.RUnlock()
+	now := m.now()
+	for i, key := range keys {
+		md, ok := m.m[key.String()]
+		if !ok || m.expired(key.String(), now) {
+			errs[i] = ErrNotFound
+			continue
+		}
+		errs[i] = load(md, models[i])
+	}
+	return batchErr(errs)
+}
+
+func (m *Mem) DeleteMany(keys []model.Key) error {
+	m.mx.Lock()
+	defer m.mx.Unlock()
+	for _, key := range keys {
+		m.delete(key.String())
+	}
+	return nil
+}
+
+// Scan walks keys in lexical order. The cursor is the last key returned, so
+// it stays valid across concurrent writes: keys added behind it are skipped,
+// keys added ahead of it are returned.
+func (m *Mem) Scan(prefix, cursor string, limit int) ([]string, string, error) {
+	m.mx.RLock()
+	now := m.now()
+	var keys []string
+	for k := range m.m {
+		if strings.HasPrefix(k, prefix) && k > cursor && !m.expired(k, now) {
+			keys = append(keys, k)
+		}
+	}
+	m.mx.RUnlock()
+
+	sort.Strings(keys)
+	if limit <= 0 || len(keys) <= limit {
+		return keys, "", nil
+	}
+	keys = keys[:limit]
+	return keys, keys[limit-1], nil
+}
+
+// snapshot is the binary form of a model stored by a Mem in copy mode.
+type snapshot []byte
+
+func (s *snapshot) MarshalBinary() ([]byte, error) {
+	return append([]byte(nil), *s...), nil
+}
+
+func (s *snapshot) UnmarshalBinary(b []byte) error {
+	*s = append((*s)[:0], b...)
+	return nil
+}
+
+func (s *snapshot) Set(m model.Model) error {
+	b, err := m.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	return s.UnmarshalBinary(b)
+}
+
+func (m *Mem) GetVersion(key model.Key, model model.Model) (string, error) {
+	k := key.String()
 	m.mx.RLock()
 	defer m.mx.RUnlock()
-	md, ok := m.m[key.String()]
-	if !ok {
+	md, ok := m.m[k]
+	if !ok || m.expired(k, m.now()) {
+		return "", ErrNotFound
+	}
+	b, err := md.MarshalBinary()
+	if err != nil {
+		return "", err
+	}
+	if err := load(md, model); err != nil {
+		return "", err
+	}
+	return versionOf(b), nil
+}
+
+func (m *Mem) SaveIfVersion(key model.Key, model model.Model, version string) (string, error) {
+	b, err := model.MarshalBinary()
+	if err != nil {
+		return "", err
+	}
+	stored := model
+	if m.copy {
+		s := snapshot(b)
+		stored = &s
+	}
+
+	k := key.String()
+	m.mx.Lock()
+	defer m.mx.Unlock()
+	var cur string
+	if md, ok := m.m[k]; ok && !m.expired(k, m.now()) {
+		mb, err := md.MarshalBinary()
+		if err != nil {
+			return "", err
+		}
+		cur = versionOf(mb)
+	}
+	if cur != version {
+		return "", ErrConflict
+	}
+	m.m[k] = stored
+	delete(m.exp, k)
+	m.notify(OpSave, k, stored)
+	return versionOf(b), nil
+}
+
+func (m *Mem) DeleteIfVersion(key model.Key, version string) error {
+	k := key.String()
+	m.mx.Lock()
+	defer m.mx.Unlock()
+	md, ok := m.m[k]
+	if !ok || m.expired(k, m.now()) {
 		return ErrNotFound
 	}
-	return model.Set(md)
+	b, err := md.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	if versionOf(b) != version {
+		return ErrConflict
+	}
+	m.delete(k)
+	return nil
+}
+
+func (m *Mem) GetVersionContext(ctx context.Context, key model.Key, model model.Model) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	return m.GetVersion(key, model)
+}
+
+func (m *Mem) SaveIfVersionContext(ctx context.Context, key model.Key, model model.Model, version string) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	return m.SaveIfVersion(key, model, version)
+}
+
+func (m *Mem) DeleteIfVersionContext(ctx context.Context, key model.Key, version string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return m.DeleteIfVersion(key, version)
+}
+
+func (m *Mem) Begin() (Tx, error) {
+	return newStagedTx(m, m.commit), nil
+}
+
+// commit applies a transaction's write-set under a single lock acquisition.
+func (m *Mem) commit(ops []txOp) error {
+	stored := make([]model.Model, len(ops))
+	for i, op := range ops {
+		if op.delete {
+			continue
+		}
+		var err error
+		if stored[i], err = m.store(op.model); err != nil {
+			return err
+		}
+	}
+	m.mx.Lock()
+	defer m.mx.Unlock()
+	for i, op := range ops {
+		if op.delete {
+			m.delete(op.key)
+			continue
+		}
+		m.m[op.key] = stored[i]
+		delete(m.exp, op.key)
+		m.notify(OpSave, op.key, stored[i])
+	}
+	return nil
 }
@@ -0,0 +1,112 @@
+package db
+
+import (
+	"errors"
+	"github.com/llitfkitfk/GoHighPerformance/pkg/model"
+	"testing"
+	"time"
+)
+
+func TestMemTTL(t *testing.T) {
+	m := NewMem()
+	now := time.Now()
+	m.now = func() time.Time { return now }
+
+	if err := m.SaveWithTTL(testKey("a"), &testModel{Val: "x"}, time.Second); err != nil {
+		t.Fatalf("SaveWithTTL: %s", err)
+	}
+	var got testModel
+	if err := m.Get(testKey("a"), &got); err != nil {
+		t.Fatalf("Get before expiry: %s", err)
+	}
+
+	now = now.Add(time.Second)
+	if err := m.Get(testKey("a"), &got); err != ErrNotFound {
+		t.Fatalf("Get after expiry = %v, want ErrNotFound", err)
+	}
+	if _, ok := m.m["a"]; ok {
+		t.Fatal("expired key was not evicted by Get")
+	}
+
+	// a plain Save clears an earlier TTL
+	m.SaveWithTTL(testKey("b"), &testModel{Val: "y"}, time.Second)
+	m.Save(testKey("b"), &testModel{Val: "z"})
+	now = now.Add(time.Hour)
+	if err := m.Get(testKey("b"), &got); err != nil || got.Val != "z" {
+		t.Fatalf("Get = %q, %v; want %q, nil", got.Val, err, "z")
+	}
+}
+
+func TestMemJanitor(t *testing.T) {
+	m := NewMem()
+	m.SaveWithTTL(testKey("a"), &testModel{}, time.Millisecond)
+	m.StartJanitor(time.Millisecond)
+	defer m.Close()
+
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		m.mx.RLock()
+		n := len(m.m)
+		m.mx.RUnlock()
+		if n == 0 {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatal("janitor did not remove expired key")
+}
+
+func TestMemCopy(t *testing.T) {
+	m := NewMemCopy()
+	saved := &testModel{Val: "before"}
+	if err := m.Save(testKey("a"), saved); err != nil {
+		t.Fatalf("Save: %s", err)
+	}
+	saved.Val = "after"
+
+	var got testModel
+	if err := m.Get(testKey("a"), &got); err != nil || got.Val != "before" {
+		t.Fatalf("Get = %q, %v; want %q, nil", got.Val, err, "before")
+	}
+
+	// without copy mode the stored value aliases the caller's model
+	shared := NewMem()
+	shared.Save(testKey("a"), saved)
+	saved.Val = "changed"
+	shared.Get(testKey("a"), &got)
+	if got.Val != "changed" {
+		t.Fatalf("shared Get = %q, want %q", got.Val, "changed")
+	}
+}
+
+type badModel struct {
+	testModel
+}
+
+func (b *badModel) MarshalBinary() ([]byte, error) {
+	return nil, errors.New("cannot marshal")
+}
+
+func TestMemCopyMarshalError(t *testing.T) {
+	m := NewMemCopy()
+	if err := m.Save(testKey("a"), &badModel{}); err == nil {
+		t.Fatal("Save of unmarshalable model returned nil error")
+	}
+	if err := NewMem().Save(testKey("a"), &badModel{}); err != nil {
+		t.Fatalf("Save without copy mode: %s", err)
+	}
+
+	// a bad model fails only its own key in a batch
+	err := m.SaveMany([]model.Key{testKey("a"), testKey("b")}, []model.Model{&badModel{}, &testModel{Val: "b"}})
+	berr, ok := err.(BatchError)
+	if !ok || berr[0] == nil || berr[1] != nil {
+		t.Fatalf("SaveMany error = %v, want BatchError failing only the first key", err)
+	}
+	if err := m.Get(testKey("a"), &testModel{}); err != ErrNotFound {
+		t.Fatalf("Get of failed key = %v, want ErrNotFound", err)
+	}
+	var got testModel
+	if err := m.Get(testKey("b"), &got); err != nil || got.Val != "b" {
+		t.Fatalf("Get of saved key = %+v, %v", got, err)
+	}
+}
@@ -1,26 +1,510 @@
 package db
 
 import (
+	"context"
+	"errors"
 	"github.com/llitfkitfk/GoHighPerformance/pkg/model"
 	"gopkg.in/redis.v5"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
 )
 
+// RedisClient is the part of the go-redis API that Redis needs. It is
+// satisfied by *redis.Client, whether built by NewClient or by
+// NewFailoverClient for Sentinel, and by *redis.ClusterClient. On a cluster,
+// Scan only walks the node it happens to reach, transactions and batches
+// must keep their keys in one hash slot, e.g. with {hash tags}, and Watch is
+// not available.
+type RedisClient interface {
+	redis.Cmdable
+
+	TxPipeline() *redis.Pipeline
+
+	Watch(fn func(*redis.Tx) error, keys ...string) error
+}
+
+var (
+	_ RedisClient = (*redis.Client)(nil)
+	_ RedisClient = (*redis.ClusterClient)(nil)
+)
+
+// psubscriber is implemented by clients that support pattern subscriptions,
+// which *redis.ClusterClient does not.
+type psubscriber interface {
+	PSubscribe(channels ...string) (*redis.PubSub, error)
+}
+
+var errNoPubSub = errors.New("redis client does not support PSUBSCRIBE, Watch needs a non-cluster client")
+
 type Redis struct {
-	client *redis.Client
+	client  RedisClient
+	publish bool
+	dropped uint64
 }
 
-func NewRedis(client *redis.Client) *Redis {
+func NewRedis(client RedisClient) *Redis {
 	return &Redis{client: client}
 }
 
-func (r *Redis) Save(model.Key, model.Model) error {
-	return nil
+// PublishChanges makes every write also publish an event on a pub/sub channel
+// named after the key, which is what Watch listens to. Call it before the
+// Redis is used, on every instance that writes.
+func (r *Redis) PublishChanges() {
+	r.publish = true
+}
+
+func (r *Redis) Save(key model.Key, model model.Model) error {
+	b, err := model.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	return r.set(key.String(), b, 0)
+}
+
+// SaveWithTTL saves model with a native Redis expiry. A ttl <= 0 never expires.
+func (r *Redis) SaveWithTTL(key model.Key, model model.Model, ttl time.Duration) error {
+	if ttl < 0 {
+		ttl = 0
+	}
+	b, err := model.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	return r.set(key.String(), b, ttl)
+}
+
+func (r *Redis) Delete(key model.Key) error {
+	return r.del(key.String())
+}
+
+// set writes b to k, together with its change event if publishing is on.
+func (r *Redis) set(k string, b []byte, ttl time.Duration) error {
+	if !r.publish {
+		return r.client.Set(k, b, ttl).Err()
+	}
+	pipe := r.client.TxPipeline()
+	defer pipe.Close()
+	pipe.Set(k, b, ttl)
+	pipe.Publish(changePrefix+k, changeSave+string(b))
+	_, err := pipe.Exec()
+	return err
+}
+
+// del deletes k and, if publishing is on and k existed, publishes the change.
+func (r *Redis) del(k string) error {
+	if !r.publish {
+		return r.client.Del(k).Err()
+	}
+	return r.client.Eval(delAndPublish, []string{k}, changePrefix+k).Err()
+}
+
+func (r *Redis) Get(key model.Key, model model.Model) error {
+	b, err := r.get(key)
+	if err != nil {
+		return err
+	}
+	return model.UnmarshalBinary(b)
+}
+
+func (r *Redis) get(key model.Key) ([]byte, error) {
+	b, err := r.client.Get(key.String()).Bytes()
+	if err == redis.Nil {
+		return nil, ErrNotFound
+	}
+	return b, err
+}
+
+func (r *Redis) SaveContext(ctx context.Context, key model.Key, model model.Model) error {
+	b, err := model.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	return r.do(ctx, func() error {
+		return r.set(key.String(), b, 0)
+	})
+}
+
+func (r *Redis) DeleteContext(ctx context.Context, key model.Key) error {
+	return r.do(ctx, func() error {
+		return r.Delete(key)
+	})
+}
+
+func (r *Redis) GetContext(ctx context.Context, key model.Key, model model.Model) error {
+	var b []byte
+	err := r.do(ctx, func() error {
+		var err error
+		b, err = r.get(key)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	// unmarshal on the caller's goroutine so a cancelled call never touches model
+	return model.UnmarshalBinary(b)
+}
+
+// Ping sends PING, giving up when ctx is done.
+func (r *Redis) Ping(ctx context.Context) error {
+	return r.do(ctx, func() error {
+		return r.client.Ping().Err()
+	})
+}
+
+// do runs fn in its own goroutine and returns early if ctx is done first. The
+// client has no context support, so an abandoned command still runs until the
+// client's read/write timeouts fire, but it no longer holds up the caller.
+func (r *Redis) do(ctx context.Context, fn func() error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	errc := make(chan error, 1)
+	go func() {
+		errc <- fn()
+	}()
+	select {
+	case err := <-errc:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (r *Redis) SaveMany(keys []model.Key, models []model.Model) error {
+	if len(keys) != len(models) {
+		return ErrBatchSize
+	}
+	errs := make([]error, len(keys))
+	cmds := make([]*redis.StatusCmd, len(keys))
+	pipe := r.client.Pipeline()
+	defer pipe.Close()
+	for i, key := range keys {
+		b, err := models[i].MarshalBinary()
+		if err != nil {
+			errs[i] = err
+			continue
+		}
+		cmds[i] = pipe.Set(key.String(), b, 0)
+		if r.publish {
+			pipe.Publish(changePrefix+key.String(), changeSave+string(b))
+		}
+	}
+	// Exec only reports the first failure, so look at each command instead.
+	pipe.Exec()
+	for i, cmd := range cmds {
+		if cmd != nil {
+			errs[i] = cmd.Err()
+		}
+	}
+	return batchErr(errs)
+}
+
+func (r *Redis) GetMany(keys []model.Key, models []model.Model) error {
+	if len(keys) != len(models) {
+		return ErrBatchSize
+	}
+	errs := make([]error, len(keys))
+	cmds := make([]*redis.StringCmd, len(keys))
+	pipe := r.client.Pipeline()
+	defer pipe.Close()
+	for i, key := range keys {
+		cmds[i] = pipe.Get(key.String())
+	}
+	pipe.Exec()
+	for i, cmd := range cmds {
+		b, err := cmd.Bytes()
+		switch {
+		case err == redis.Nil:
+			errs[i] = ErrNotFound
+		case err != nil:
+			errs[i] = err
+		default:
+			errs[i] = models[i].UnmarshalBinary(b)
+		}
+	}
+	return batchErr(errs)
+}
+
+func (r *Redis) DeleteMany(keys []model.Key) error {
+	errs := make([]error, len(keys))
+	cmds := make([]redis.Cmder, len(keys))
+	pipe := r.client.Pipeline()
+	defer pipe.Close()
+	for i, key := range keys {
+		if r.publish {
+			cmds[i] = pipe.Eval(delAndPublish, []string{key.String()}, changePrefix+key.String())
+		} else {
+			cmds[i] = pipe.Del(key.String())
+		}
+	}
+	pipe.Exec()
+	for i, cmd := range cmds {
+		errs[i] = cmd.Err()
+	}
+	return batchErr(errs)
+}
+
+// Scan uses SCAN with a MATCH pattern, so the cursor is Redis' own and keys come
+// back unordered. As with SCAN, a page may hold slightly more than limit keys.
+func (r *Redis) Scan(prefix, cursor string, limit int) ([]string, string, error) {
+	var c uint64
+	if cursor != "" {
+		var err error
+		if c, err = strconv.ParseUint(cursor, 10, 64); err != nil {
+			return nil, "", ErrBadCursor
+		}
+	}
+	count := int64(limit)
+	if count <= 0 {
+		count = 100
+	}
+	match := globEscape(prefix) + "*"
+
+	var keys []string
+	for {
+		page, next, err := r.client.Scan(c, match, count).Result()
+		if err != nil {
+			return nil, "", err
+		}
+		keys = append(keys, page...)
+		c = next
+		if c == 0 {
+			return keys, "", nil
+		}
+		if limit > 0 && len(keys) >= limit {
+			return keys, strconv.FormatUint(c, 10), nil
+		}
+	}
+}
+
+func (r *Redis) GetVersion(key model.Key, model model.Model) (string, error) {
+	b, err := r.get(key)
+	if err != nil {
+		return "", err
+	}
+	if err := model.UnmarshalBinary(b); err != nil {
+		return "", err
+	}
+	return versionOf(b), nil
+}
+
+func (r *Redis) GetVersionContext(ctx context.Context, key model.Key, model model.Model) (string, error) {
+	var b []byte
+	err := r.do(ctx, func() error {
+		var err error
+		b, err = r.get(key)
+		return err
+	})
+	if err != nil {
+		return "", err
+	}
+	if err := model.UnmarshalBinary(b); err != nil {
+		return "", err
+	}
+	return versionOf(b), nil
+}
+
+// SaveIfVersion WATCHes the key, checks its version and writes the new value in
+// a MULTI/EXEC block, so a concurrent write between the check and the write
+// aborts the transaction.
+func (r *Redis) SaveIfVersion(key model.Key, model model.Model, version string) (string, error) {
+	b, err := model.MarshalBinary()
+	if err != nil {
+		return "", err
+	}
+	return r.saveIfVersion(key.String(), b, version)
+}
+
+func (r *Redis) SaveIfVersionContext(ctx context.Context, key model.Key, model model.Model, version string) (string, error) {
+	b, err := model.MarshalBinary()
+	if err != nil {
+		return "", err
+	}
+	var next string
+	err = r.do(ctx, func() error {
+		var err error
+		next, err = r.saveIfVersion(key.String(), b, version)
+		return err
+	})
+	return next, err
+}
+
+func (r *Redis) saveIfVersion(k string, b []byte, version string) (string, error) {
+	err := r.ifVersion(k, func(cur string) error {
+		if cur != version {
+			return ErrConflict
+		}
+		return nil
+	}, func(pipe *redis.Pipeline) {
+		pipe.Set(k, b, 0)
+		if r.publish {
+			pipe.Publish(changePrefix+k, changeSave+string(b))
+		}
+	})
+	if err != nil {
+		return "", err
+	}
+	return versionOf(b), nil
+}
+
+// DeleteIfVersion checks and deletes like SaveIfVersion writes.
+func (r *Redis) DeleteIfVersion(key model.Key, version string) error {
+	return r.deleteIfVersion(key.String(), version)
+}
+
+func (r *Redis) DeleteIfVersionContext(ctx context.Context, key model.Key, version string) error {
+	return r.do(ctx, func() error {
+		return r.deleteIfVersion(key.String(), version)
+	})
+}
+
+func (r *Redis) deleteIfVersion(k, version string) error {
+	return r.ifVersion(k, func(cur string) error {
+		switch cur {
+		case "":
+			return ErrNotFound
+		case version:
+			return nil
+		default:
+			return ErrConflict
+		}
+	}, func(pipe *redis.Pipeline) {
+		pipe.Del(k)
+		if r.publish {
+			pipe.Publish(changePrefix+k, changeDelete)
+		}
+	})
+}
+
+// ifVersion WATCHes k, passes its version, or "" if it is missing, to check
+// and, if check allows it, queues write in a MULTI/EXEC block. A change to k
+// before EXEC returns ErrConflict.
+func (r *Redis) ifVersion(k string, check func(cur string) error, write func(*redis.Pipeline)) error {
+	err := r.client.Watch(func(tx *redis.Tx) error {
+		var cur string
+		old, err := tx.Get(k).Bytes()
+		switch {
+		case err == nil:
+			cur = versionOf(old)
+		case err != redis.Nil:
+			return err
+		}
+		if err := check(cur); err != nil {
+			return err
+		}
+		pipe := tx.Pipeline()
+		defer pipe.Close()
+		write(pipe)
+		_, err = pipe.Exec()
+		return err
+	}, k)
+	if err == redis.TxFailedErr {
+		return ErrConflict
+	}
+	return err
 }
 
-func (r *Redis) Delete(model.Key) error {
-	return nil
+func (r *Redis) Begin() (Tx, error) {
+	return newStagedTx(r, r.commit), nil
+}
+
+// commit sends a transaction's write-set in one MULTI/EXEC block.
+func (r *Redis) commit(ops []txOp) error {
+	vals := make([][]byte, len(ops))
+	for i, op := range ops {
+		if op.delete {
+			continue
+		}
+		var err error
+		if vals[i], err = op.model.MarshalBinary(); err != nil {
+			return err
+		}
+	}
+	pipe := r.client.TxPipeline()
+	defer pipe.Close()
+	for i, op := range ops {
+		switch {
+		case op.delete && r.publish:
+			pipe.Eval(delAndPublish, []string{op.key}, changePrefix+op.key)
+		case op.delete:
+			pipe.Del(op.key)
+		default:
+			pipe.Set(op.key, vals[i], 0)
+			if r.publish {
+				pipe.Publish(changePrefix+op.key, changeSave+string(vals[i]))
+			}
+		}
+	}
+	_, err := pipe.Exec()
+	return err
+}
+
+// Changes are published on changePrefix+key. The payload is changeSave
+// followed by the new value, or changeDelete.
+const (
+	changePrefix = "__changes__:"
+	changeSave   = "s"
+	changeDelete = "d"
+)
+
+// delAndPublish deletes KEYS[1] and publishes a delete event on ARGV[1] only
+// if the key existed, matching what Mem reports.
+const delAndPublish = `if redis.call("DEL", KEYS[1]) == 1 then redis.call("PUBLISH", ARGV[1], "` + changeDelete + `") end return 0`
+
+// Watch implements Watcher with a pattern subscription, so it only sees writes
+// made by Redis instances with PublishChanges on. Events that do not fit in
+// the channel's buffer are dropped and counted by DroppedEvents.
+func (r *Redis) Watch(ctx context.Context, prefix string) (<-chan Event, error) {
+	sub, ok := r.client.(psubscriber)
+	if !ok {
+		return nil, errNoPubSub
+	}
+	ps, err := sub.PSubscribe(changePrefix + globEscape(prefix) + "*")
+	if err != nil {
+		return nil, err
+	}
+	// wait for the subscription to be confirmed so that no write made after
+	// Watch returns is missed
+	if _, err := ps.Receive(); err != nil {
+		ps.Close()
+		return nil, err
+	}
+
+	ch := make(chan Event, feedBuffer)
+	go func() {
+		<-ctx.Done()
+		ps.Close()
+	}()
+	go func() {
+		defer close(ch)
+		for {
+			msg, err := ps.ReceiveMessage()
+			if err != nil {
+				return
+			}
+			ev := Event{Key: strings.TrimPrefix(msg.Channel, changePrefix)}
+			switch {
+			case strings.HasPrefix(msg.Payload, changeSave):
+				ev.Op = OpSave
+				ev.Value = []byte(msg.Payload[len(changeSave):])
+			case msg.Payload == changeDelete:
+				ev.Op = OpDelete
+			default:
+				continue
+			}
+			select {
+			case ch <- ev:
+			default:
+				atomic.AddUint64(&r.dropped, 1)
+			}
+		}
+	}()
+	return ch, nil
 }
 
-func (r *Redis) Get(model.Key, model.Model) error {
-	return nil
+// DroppedEvents returns how many events slow watchers have missed.
+func (r *Redis) DroppedEvents() uint64 {
+	return atomic.LoadUint64(&r.dropped)
 }
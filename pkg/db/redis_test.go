@@ -0,0 +1,106 @@
+package db
+
+import (
+	"context"
+	"github.com/alicebob/miniredis/v2"
+	"gopkg.in/redis.v5"
+	"testing"
+	"time"
+)
+
+func newTestRedis(t *testing.T) (*Redis, *miniredis.Miniredis) {
+	s, err := miniredis.Run()
+	if err != nil {
+		t.Fatalf("starting miniredis: %s", err)
+	}
+	client := redis.NewClient(&redis.Options{Addr: s.Addr()})
+	return NewRedis(client), s
+}
+
+func TestRedisSaveGetDelete(t *testing.T) {
+	r, s := newTestRedis(t)
+	defer s.Close()
+
+	key := testKey("a")
+	if err := r.Save(key, &testModel{Val: "hello"}); err != nil {
+		t.Fatalf("Save: %s", err)
+	}
+	if got, _ := s.Get("a"); got != "hello" {
+		t.Fatalf("stored value = %q, want %q", got, "hello")
+	}
+
+	var m testModel
+	if err := r.Get(key, &m); err != nil {
+		t.Fatalf("Get: %s", err)
+	}
+	if m.Val != "hello" {
+		t.Fatalf("Get = %q, want %q", m.Val, "hello")
+	}
+
+	if err := r.Delete(key); err != nil {
+		t.Fatalf("Delete: %s", err)
+	}
+	if err := r.Get(key, &m); err != ErrNotFound {
+		t.Fatalf("Get after Delete = %v, want ErrNotFound", err)
+	}
+}
+
+func TestRedisGetMissing(t *testing.T) {
+	r, s := newTestRedis(t)
+	defer s.Close()
+
+	var m testModel
+	if err := r.Get(testKey("missing"), &m); err != ErrNotFound {
+		t.Fatalf("Get = %v, want ErrNotFound", err)
+	}
+}
+
+func TestRedisConnectionError(t *testing.T) {
+	r, s := newTestRedis(t)
+	s.Close()
+
+	if err := r.Save(testKey("a"), &testModel{Val: "x"}); err == nil {
+		t.Fatal("Save against closed server returned nil error")
+	}
+	var m testModel
+	if err := r.Get(testKey("a"), &m); err == nil || err == ErrNotFound {
+		t.Fatalf("Get against closed server = %v, want connection error", err)
+	}
+}
+
+func TestRedisContextCancelled(t *testing.T) {
+	r, s := newTestRedis(t)
+	defer s.Close()
+
+	if err := r.Save(testKey("a"), &testModel{Val: "x"}); err != nil {
+		t.Fatalf("Save: %s", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var m testModel
+	if err := r.GetContext(ctx, testKey("a"), &m); err != nil || m.Val != "x" {
+		t.Fatalf("GetContext = %q, %v; want %q, nil", m.Val, err, "x")
+	}
+
+	cancel()
+	if err := r.GetContext(ctx, testKey("a"), &m); err != context.Canceled {
+		t.Fatalf("GetContext with cancelled ctx = %v, want context.Canceled", err)
+	}
+}
+
+func TestRedisTTL(t *testing.T) {
+	r, s := newTestRedis(t)
+	defer s.Close()
+
+	if err := r.SaveWithTTL(testKey("a"), &testModel{Val: "x"}, time.Minute); err != nil {
+		t.Fatalf("SaveWithTTL: %s", err)
+	}
+	if ttl := s.TTL("a"); ttl != time.Minute {
+		t.Fatalf("TTL = %s, want %s", ttl, time.Minute)
+	}
+	s.FastForward(time.Minute)
+	var m testModel
+	if err := r.Get(testKey("a"), &m); err != ErrNotFound {
+		t.Fatalf("Get after expiry = %v, want ErrNotFound", err)
+	}
+}
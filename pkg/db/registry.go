@@ -0,0 +1,58 @@
+package db
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// ConfigFunc fills spec, a pointer to a struct with envconfig tags, from the
+// application's configuration. It lets each backend declare its own settings.
+type ConfigFunc func(spec interface{}) error
+
+// Factory creates a backend, reading whatever settings it needs through conf.
+type Factory func(conf ConfigFunc) (DB, error)
+
+var (
+	registryMx sync.RWMutex
+	registry   = make(map[string]Factory)
+)
+
+// Register makes a backend available to Open under name. It is meant to be
+// called from init functions and panics if name is taken or f is nil, like
+// database/sql.Register.
+func Register(name string, f Factory) {
+	registryMx.Lock()
+	defer registryMx.Unlock()
+	if f == nil {
+		panic("db: Register factory is nil for " + name)
+	}
+	if _, dup := registry[name]; dup {
+		panic("db: Register called twice for " + name)
+	}
+	registry[name] = f
+}
+
+// Backends returns the sorted names of the registered backends.
+func Backends() []string {
+	registryMx.RLock()
+	defer registryMx.RUnlock()
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Open creates the backend registered under name.
+func Open(name string, conf ConfigFunc) (DB, error) {
+	registryMx.RLock()
+	f, ok := registry[name]
+	registryMx.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown DB type %q, available: %s", name, strings.Join(Backends(), ", "))
+	}
+	return f(conf)
+}
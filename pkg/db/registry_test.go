@@ -0,0 +1,38 @@
+package db
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRegistry(t *testing.T) {
+	Register("test-registry", func(conf ConfigFunc) (DB, error) {
+		var spec struct{ Name string }
+		if err := conf(&spec); err != nil {
+			return nil, err
+		}
+		if spec.Name != "configured" {
+			t.Errorf("spec.Name = %q, want %q", spec.Name, "configured")
+		}
+		return NewMem(), nil
+	})
+	conf := func(spec interface{}) error {
+		spec.(*struct{ Name string }).Name = "configured"
+		return nil
+	}
+
+	if _, err := Open("test-registry", conf); err != nil {
+		t.Fatalf("Open: %s", err)
+	}
+	_, err := Open("nope", conf)
+	if err == nil || !strings.Contains(err.Error(), "test-registry") {
+		t.Fatalf("Open(nope) = %v, want an error listing test-registry", err)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Fatal("registering a name twice did not panic")
+		}
+	}()
+	Register("test-registry", func(ConfigFunc) (DB, error) { return nil, nil })
+}
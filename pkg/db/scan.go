@@ -0,0 +1,30 @@
+package db
+
+import (
+	"errors"
+	"strings"
+)
+
+// ErrBadCursor is returned by Scan for a cursor it did not hand out.
+var ErrBadCursor = errors.New("invalid scan cursor")
+
+// Scanner is implemented by backends that can enumerate their keys.
+type Scanner interface {
+	// Scan returns keys starting with prefix together with the cursor to pass
+	// to the next call. Pass an empty cursor to start; an empty next cursor
+	// means the iteration is complete. limit <= 0 means no limit.
+	Scan(prefix, cursor string, limit int) (keys []string, next string, err error)
+}
+
+// globEscape quotes the characters Redis MATCH patterns treat specially.
+func globEscape(s string) string {
+	var b strings.Builder
+	for _, c := range s {
+		switch c {
+		case '*', '?', '[', ']', '\\':
+			b.WriteByte('\\')
+		}
+		b.WriteRune(c)
+	}
+	return b.String()
+}
@@ -0,0 +1,66 @@
+package db
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func scanAll(t *testing.T, s Scanner, prefix string, limit int) []string {
+	var all []string
+	cursor := ""
+	for {
+		keys, next, err := s.Scan(prefix, cursor, limit)
+		if err != nil {
+			t.Fatalf("Scan: %s", err)
+		}
+		all = append(all, keys...)
+		if next == "" {
+			return all
+		}
+		cursor = next
+	}
+}
+
+func TestMemScan(t *testing.T) {
+	m := NewMem()
+	for _, k := range []string{"user/3", "user/1", "order/1", "user/2"} {
+		m.Save(testKey(k), &testModel{})
+	}
+
+	keys, next, err := m.Scan("user/", "", 2)
+	if err != nil {
+		t.Fatalf("Scan: %s", err)
+	}
+	if want := []string{"user/1", "user/2"}; !reflect.DeepEqual(keys, want) || next != "user/2" {
+		t.Fatalf("Scan = %v, %q; want %v, %q", keys, next, want, "user/2")
+	}
+
+	// a key inserted behind the cursor must not disturb the next page
+	m.Save(testKey("user/0"), &testModel{})
+	keys, next, _ = m.Scan("user/", next, 2)
+	if want := []string{"user/3"}; !reflect.DeepEqual(keys, want) || next != "" {
+		t.Fatalf("second Scan = %v, %q; want %v, \"\"", keys, next, want)
+	}
+}
+
+func TestRedisScan(t *testing.T) {
+	r, s := newTestRedis(t)
+	defer s.Close()
+	for _, k := range []string{"user/1", "user/2", "user/*", "order/1"} {
+		r.Save(testKey(k), &testModel{})
+	}
+
+	got := scanAll(t, r, "user/", 1)
+	sort.Strings(got)
+	if want := []string{"user/*", "user/1", "user/2"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("Scan = %v, want %v", got, want)
+	}
+
+	if got := scanAll(t, r, "user/*", 0); !reflect.DeepEqual(got, []string{"user/*"}) {
+		t.Fatalf("Scan with glob prefix = %v, want [user/*]", got)
+	}
+	if _, _, err := r.Scan("user/", "user/1", 1); err != ErrBadCursor {
+		t.Fatalf("Scan with foreign cursor = %v, want ErrBadCursor", err)
+	}
+}
@@ -0,0 +1,103 @@
+package db
+
+import (
+	"context"
+	"github.com/llitfkitfk/GoHighPerformance/pkg/model"
+	"sort"
+	"time"
+)
+
+// ShardedMem spreads keys over independently locked Mem shards so that writes
+// to different keys do not contend on a single mutex.
+type ShardedMem struct {
+	shards []*Mem
+}
+
+func NewShardedMem(n int) *ShardedMem {
+	if n < 1 {
+		n = 1
+	}
+	s := &ShardedMem{shards: make([]*Mem, n)}
+	for i := range s.shards {
+		s.shards[i] = NewMem()
+	}
+	return s
+}
+
+// shard picks the shard for k with an inlined FNV-1a, avoiding the allocation
+// of a hash.Hash32 on every call.
+func (s *ShardedMem) shard(k string) *Mem {
+	h := uint32(2166136261)
+	for i := 0; i < len(k); i++ {
+		h ^= uint32(k[i])
+		h *= 16777619
+	}
+	return s.shards[h%uint32(len(s.shards))]
+}
+
+func (s *ShardedMem) Save(key model.Key, model model.Model) error {
+	return s.shard(key.String()).Save(key, model)
+}
+
+func (s *ShardedMem) SaveWithTTL(key model.Key, model model.Model, ttl time.Duration) error {
+	return s.shard(key.String()).SaveWithTTL(key, model, ttl)
+}
+
+func (s *ShardedMem) Delete(key model.Key) error {
+	return s.shard(key.String()).Delete(key)
+}
+
+func (s *ShardedMem) Get(key model.Key, model model.Model) error {
+	return s.shard(key.String()).Get(key, model)
+}
+
+func (s *ShardedMem) SaveContext(ctx context.Context, key model.Key, model model.Model) error {
+	return s.shard(key.String()).SaveContext(ctx, key, model)
+}
+
+func (s *ShardedMem) DeleteContext(ctx context.Context, key model.Key) error {
+	return s.shard(key.String()).DeleteContext(ctx, key)
+}
+
+func (s *ShardedMem) GetContext(ctx context.Context, key model.Key, model model.Model) error {
+	return s.shard(key.String()).GetContext(ctx, key, model)
+}
+
+// Scan merges the pages of every shard, so it keeps Mem's lexical order and
+// last-key cursor.
+func (s *ShardedMem) Scan(prefix, cursor string, limit int) ([]string, string, error) {
+	var keys []string
+	for _, sh := range s.shards {
+		page, _, err := sh.Scan(prefix, cursor, limit)
+		if err != nil {
+			return nil, "", err
+		}
+		keys = append(keys, page...)
+	}
+	sort.Strings(keys)
+	if limit <= 0 || len(keys) <= limit {
+		return keys, "", nil
+	}
+	keys = keys[:limit]
+	return keys, keys[limit-1], nil
+}
+
+func (s *ShardedMem) DeleteExpired() {
+	for _, sh := range s.shards {
+		sh.DeleteExpired()
+	}
+}
+
+// StartJanitor starts one janitor per shard; Close stops them all.
+func (s *ShardedMem) StartJanitor(interval time.Duration) {
+	for _, sh := range s.shards {
+		sh.StartJanitor(interval)
+	}
+}
+
+func (s *ShardedMem) Close() error {
+	for _, sh := range s.shards {
+		sh.Close()
+	}
+	return nil
+}
@@ -0,0 +1,66 @@
+package db
+
+import (
+	"reflect"
+	"strconv"
+	"sync/atomic"
+	"testing"
+)
+
+func TestShardedMem(t *testing.T) {
+	s := NewShardedMem(8)
+	for i := 0; i < 100; i++ {
+		if err := s.Save(testKey("k/"+strconv.Itoa(i)), &testModel{Val: strconv.Itoa(i)}); err != nil {
+			t.Fatalf("Save: %s", err)
+		}
+	}
+
+	var m testModel
+	if err := s.Get(testKey("k/42"), &m); err != nil || m.Val != "42" {
+		t.Fatalf("Get = %q, %v; want %q, nil", m.Val, err, "42")
+	}
+	s.Delete(testKey("k/42"))
+	if err := s.Get(testKey("k/42"), &m); err != ErrNotFound {
+		t.Fatalf("Get after Delete = %v, want ErrNotFound", err)
+	}
+
+	keys, next, _ := s.Scan("k/1", "", 3)
+	if want := []string{"k/1", "k/10", "k/11"}; !reflect.DeepEqual(keys, want) || next != "k/11" {
+		t.Fatalf("Scan = %v, %q; want %v, %q", keys, next, want, "k/11")
+	}
+	if all := scanAll(t, s, "k/", 7); len(all) != 99 {
+		t.Fatalf("scanned %d keys, want 99", len(all))
+	}
+}
+
+const benchKeys = 1024
+
+func benchmarkParallel(b *testing.B, d DB, writeEvery int) {
+	keys := make([]testKey, benchKeys)
+	for i := range keys {
+		keys[i] = testKey("key/" + strconv.Itoa(i))
+		d.Save(keys[i], &testModel{Val: "v"})
+	}
+	var seed int64
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		i := int(atomic.AddInt64(&seed, 7919))
+		var m testModel
+		for pb.Next() {
+			i++
+			k := keys[i%benchKeys]
+			if i%writeEvery == 0 {
+				d.Save(k, &testModel{Val: "v"})
+			} else {
+				d.Get(k, &m)
+			}
+		}
+	})
+}
+
+func BenchmarkMemRead90(b *testing.B)        { benchmarkParallel(b, NewMem(), 10) }
+func BenchmarkShardedMemRead90(b *testing.B) { benchmarkParallel(b, NewShardedMem(64), 10) }
+func BenchmarkMemRead50(b *testing.B)        { benchmarkParallel(b, NewMem(), 2) }
+func BenchmarkShardedMemRead50(b *testing.B) { benchmarkParallel(b, NewShardedMem(64), 2) }
+func BenchmarkMemWrite(b *testing.B)         { benchmarkParallel(b, NewMem(), 1) }
+func BenchmarkShardedMemWrite(b *testing.B)  { benchmarkParallel(b, NewShardedMem(64), 1) }
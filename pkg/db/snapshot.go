@@ -0,0 +1,180 @@
+package db
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"github.com/llitfkitfk/GoHighPerformance/pkg/model"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+var ErrCorruptSnapshot = errors.New("corrupt snapshot")
+
+// Snapshotter is implemented by stores that can dump their contents to a file
+// and load them back.
+type Snapshotter interface {
+	SaveSnapshot(path string) error
+	LoadSnapshot(path string) error
+}
+
+// A snapshot is a magic header, a sequence of records and a trailing crc32c of
+// everything before it. Each record is
+//
+//	key length(4) key value length(4) value expiry(8)
+//
+// where value is the MarshalBinary form of the model and expiry is a Unix
+// nanosecond deadline, or 0 for none.
+var snapshotMagic = []byte("GHPSNAP1")
+
+// WriteSnapshot writes every live entry of m to w.
+func (m *Mem) WriteSnapshot(w io.Writer) error {
+	type entry struct {
+		key    string
+		stored model.Model
+		exp    time.Time
+	}
+	m.mx.RLock()
+	now := m.now()
+	entries := make([]entry, 0, len(m.m))
+	for k, md := range m.m {
+		if !m.expired(k, now) {
+			entries = append(entries, entry{key: k, stored: md, exp: m.exp[k]})
+		}
+	}
+	m.mx.RUnlock()
+
+	crc := crc32.New(crcTable)
+	bw := bufio.NewWriter(io.MultiWriter(w, crc))
+	bw.Write(snapshotMagic)
+	var buf [8]byte
+	for _, e := range entries {
+		val, err := e.stored.MarshalBinary()
+		if err != nil {
+			return err
+		}
+		binary.BigEndian.PutUint32(buf[:4], uint32(len(e.key)))
+		bw.Write(buf[:4])
+		bw.WriteString(e.key)
+		binary.BigEndian.PutUint32(buf[:4], uint32(len(val)))
+		bw.Write(buf[:4])
+		bw.Write(val)
+		var exp int64
+		if !e.exp.IsZero() {
+			exp = e.exp.UnixNano()
+		}
+		binary.BigEndian.PutUint64(buf[:], uint64(exp))
+		bw.Write(buf[:])
+	}
+	if err := bw.Flush(); err != nil {
+		return err
+	}
+	binary.BigEndian.PutUint32(buf[:4], crc.Sum32())
+	_, err := w.Write(buf[:4])
+	return err
+}
+
+// ReadSnapshot replaces the contents of m with the snapshot in r. Models are
+// kept in their binary form and restored through UnmarshalBinary on Get. If
+// the snapshot is corrupt m is left untouched and ErrCorruptSnapshot returned.
+func (m *Mem) ReadSnapshot(r io.Reader) error {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	if len(data) < len(snapshotMagic)+4 || !bytes.Equal(data[:len(snapshotMagic)], snapshotMagic) {
+		return ErrCorruptSnapshot
+	}
+	body, sum := data[:len(data)-4], data[len(data)-4:]
+	if crc32.Checksum(body, crcTable) != binary.BigEndian.Uint32(sum) {
+		return ErrCorruptSnapshot
+	}
+
+	now := m.now()
+	items := make(map[string]*snapshot)
+	exps := make(map[string]time.Time)
+	body = body[len(snapshotMagic):]
+	for len(body) > 0 {
+		key, rest, ok := readChunk(body)
+		if !ok {
+			return ErrCorruptSnapshot
+		}
+		val, rest, ok := readChunk(rest)
+		if !ok || len(rest) < 8 {
+			return ErrCorruptSnapshot
+		}
+		exp := int64(binary.BigEndian.Uint64(rest))
+		body = rest[8:]
+
+		if exp != 0 {
+			d := time.Unix(0, exp)
+			if !now.Before(d) {
+				continue
+			}
+			exps[string(key)] = d
+		}
+		s := snapshot(val)
+		items[string(key)] = &s
+	}
+
+	m.mx.Lock()
+	defer m.mx.Unlock()
+	m.m = make(map[string]model.Model, len(items))
+	for k, s := range items {
+		m.m[k] = s
+	}
+	m.exp = exps
+	return nil
+}
+
+// readChunk splits a 4-byte length-prefixed chunk off the front of b.
+func readChunk(b []byte) (chunk, rest []byte, ok bool) {
+	if len(b) < 4 {
+		return nil, nil, false
+	}
+	n := binary.BigEndian.Uint32(b)
+	b = b[4:]
+	if uint64(len(b)) < uint64(n) {
+		return nil, nil, false
+	}
+	return b[:n], b[n:], true
+}
+
+// SaveSnapshot atomically replaces the file at path with a snapshot of m.
+func (m *Mem) SaveSnapshot(path string) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	if err := m.WriteSnapshot(tmp); err != nil {
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return err
+	}
+	syncDir(filepath.Dir(path))
+	return nil
+}
+
+// LoadSnapshot replaces the contents of m with the snapshot file at path.
+func (m *Mem) LoadSnapshot(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return m.ReadSnapshot(f)
+}
@@ -0,0 +1,54 @@
+package db
+
+import (
+	"bytes"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestMemSnapshotRoundTrip(t *testing.T) {
+	m := NewMem()
+	m.Save(testKey("a"), &testModel{Val: "1"})
+	m.SaveWithTTL(testKey("b"), &testModel{Val: "2"}, time.Hour)
+
+	path := filepath.Join(t.TempDir(), "mem.snap")
+	if err := m.SaveSnapshot(path); err != nil {
+		t.Fatalf("SaveSnapshot: %s", err)
+	}
+
+	restored := NewMem()
+	if err := restored.LoadSnapshot(path); err != nil {
+		t.Fatalf("LoadSnapshot: %s", err)
+	}
+	var got testModel
+	for k, want := range map[testKey]string{"a": "1", "b": "2"} {
+		if err := restored.Get(k, &got); err != nil || got.Val != want {
+			t.Fatalf("Get(%s) = %q, %v; want %q, nil", k, got.Val, err, want)
+		}
+	}
+	if _, ok := restored.exp["b"]; !ok {
+		t.Fatal("TTL of b was not restored")
+	}
+}
+
+func TestMemSnapshotCorrupt(t *testing.T) {
+	m := NewMem()
+	m.Save(testKey("a"), &testModel{Val: "1"})
+	var buf bytes.Buffer
+	if err := m.WriteSnapshot(&buf); err != nil {
+		t.Fatalf("WriteSnapshot: %s", err)
+	}
+	data := buf.Bytes()
+	data[len(snapshotMagic)+5] ^= 0xff
+
+	restored := NewMem()
+	restored.Save(testKey("keep"), &testModel{Val: "x"})
+	if err := restored.ReadSnapshot(bytes.NewReader(data)); err != ErrCorruptSnapshot {
+		t.Fatalf("ReadSnapshot = %v, want ErrCorruptSnapshot", err)
+	}
+	var got testModel
+	if err := restored.Get(testKey("keep"), &got); err != nil {
+		t.Fatalf("corrupt snapshot clobbered existing data: %s", err)
+	}
+}
@@ -0,0 +1,112 @@
+package db
+
+import (
+	"errors"
+	"github.com/llitfkitfk/GoHighPerformance/pkg/model"
+)
+
+var ErrTxDone = errors.New("transaction has already been committed or rolled back")
+
+// Tx stages writes to several keys and applies them atomically on Commit.
+// Reads through a Tx see its own staged writes.
+type Tx interface {
+	DB
+
+	Commit() error
+
+	Rollback() error
+}
+
+// TxDB is implemented by backends that support multi-key transactions.
+type TxDB interface {
+	Begin() (Tx, error)
+}
+
+// RunTx runs fn in a transaction, committing if fn returns nil and rolling
+// back otherwise.
+func RunTx(d TxDB, fn func(Tx) error) error {
+	tx, err := d.Begin()
+	if err != nil {
+		return err
+	}
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+type txOp struct {
+	key    string
+	model  model.Model // nil for a delete
+	delete bool
+}
+
+// stagedTx is the Tx used by Mem and Redis: writes are buffered in order and
+// handed to commit, which must apply them all or none.
+type stagedTx struct {
+	db     DB
+	commit func([]txOp) error
+	ops    []txOp
+	latest map[string]int // index in ops of the last op for each key
+	done   bool
+}
+
+func newStagedTx(db DB, commit func([]txOp) error) *stagedTx {
+	return &stagedTx{db: db, commit: commit, latest: make(map[string]int)}
+}
+
+func (t *stagedTx) stage(op txOp) error {
+	if t.done {
+		return ErrTxDone
+	}
+	t.latest[op.key] = len(t.ops)
+	t.ops = append(t.ops, op)
+	return nil
+}
+
+func (t *stagedTx) Save(key model.Key, model model.Model) error {
+	return t.stage(txOp{key: key.String(), model: model})
+}
+
+func (t *stagedTx) Delete(key model.Key) error {
+	return t.stage(txOp{key: key.String(), delete: true})
+}
+
+func (t *stagedTx) Get(key model.Key, model model.Model) error {
+	if t.done {
+		return ErrTxDone
+	}
+	i, ok := t.latest[key.String()]
+	if !ok {
+		return t.db.Get(key, model)
+	}
+	if t.ops[i].delete {
+		return ErrNotFound
+	}
+	return model.Set(t.ops[i].model)
+}
+
+func (t *stagedTx) Commit() error {
+	if t.done {
+		return ErrTxDone
+	}
+	t.done = true
+	// only the last op for each key matters
+	ops := make([]txOp, 0, len(t.latest))
+	for i, op := range t.ops {
+		if t.latest[op.key] == i {
+			ops = append(ops, op)
+		}
+	}
+	return t.commit(ops)
+}
+
+func (t *stagedTx) Rollback() error {
+	if t.done {
+		return ErrTxDone
+	}
+	t.done = true
+	t.ops = nil
+	return nil
+}
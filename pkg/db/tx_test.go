@@ -0,0 +1,76 @@
+package db
+
+import (
+	"errors"
+	"testing"
+)
+
+func testTx(t *testing.T, d interface {
+	DB
+	TxDB
+}) {
+	d.Save(testKey("old"), &testModel{Val: "old"})
+
+	err := RunTx(d, func(tx Tx) error {
+		tx.Save(testKey("obj"), &testModel{Val: "obj"})
+		tx.Save(testKey("idx"), &testModel{Val: "obj"})
+		tx.Delete(testKey("old"))
+
+		var m testModel
+		if err := tx.Get(testKey("obj"), &m); err != nil || m.Val != "obj" {
+			t.Errorf("Get of staged write = %q, %v", m.Val, err)
+		}
+		if err := tx.Get(testKey("old"), &m); err != ErrNotFound {
+			t.Errorf("Get of staged delete = %v, want ErrNotFound", err)
+		}
+		// nothing is visible outside the transaction before Commit
+		if err := d.Get(testKey("obj"), &m); err != ErrNotFound {
+			t.Errorf("Get outside tx = %v, want ErrNotFound", err)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("RunTx: %s", err)
+	}
+	var m testModel
+	for _, k := range []testKey{"obj", "idx"} {
+		if err := d.Get(k, &m); err != nil || m.Val != "obj" {
+			t.Fatalf("Get(%s) after commit = %q, %v", k, m.Val, err)
+		}
+	}
+	if err := d.Get(testKey("old"), &m); err != ErrNotFound {
+		t.Fatalf("Get(old) after commit = %v, want ErrNotFound", err)
+	}
+
+	fail := errors.New("fail")
+	err = RunTx(d, func(tx Tx) error {
+		tx.Save(testKey("obj"), &testModel{Val: "new"})
+		tx.Delete(testKey("idx"))
+		return fail
+	})
+	if err != fail {
+		t.Fatalf("RunTx = %v, want %v", err, fail)
+	}
+	if err := d.Get(testKey("obj"), &m); err != nil || m.Val != "obj" {
+		t.Fatalf("Get(obj) after rollback = %q, %v; want %q", m.Val, err, "obj")
+	}
+	if err := d.Get(testKey("idx"), &m); err != nil {
+		t.Fatalf("Get(idx) after rollback: %s", err)
+	}
+
+	tx, _ := d.Begin()
+	tx.Commit()
+	if err := tx.Save(testKey("x"), &testModel{}); err != ErrTxDone {
+		t.Fatalf("Save after Commit = %v, want ErrTxDone", err)
+	}
+}
+
+func TestMemTx(t *testing.T) {
+	testTx(t, NewMem())
+}
+
+func TestRedisTx(t *testing.T) {
+	r, s := newTestRedis(t)
+	defer s.Close()
+	testTx(t, r)
+}
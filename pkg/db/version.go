@@ -0,0 +1,46 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"github.com/llitfkitfk/GoHighPerformance/pkg/model"
+	"hash/fnv"
+	"strconv"
+)
+
+var ErrConflict = errors.New("version conflict")
+
+// VersionedDB is implemented by backends that support optimistic concurrency.
+// A version is derived from the MarshalBinary form of the stored model, so it
+// changes whenever the stored value does and can be used as an HTTP ETag.
+//
+// Because the version identifies content rather than counting writes, it does
+// not detect ABA: if the value goes from A to B and back to A, a writer still
+// holding A's version succeeds. SaveIfVersion therefore guarantees the stored
+// value is the one the caller read, not that nobody wrote in between. Callers
+// that need the latter must store their own counter in the model.
+type VersionedDB interface {
+	// GetVersion is Get that also returns the stored entry's version.
+	GetVersion(model.Key, model.Model) (string, error)
+
+	// SaveIfVersion saves model only if the stored entry still has version,
+	// and returns the new version. An empty version means the key must not
+	// exist yet. If the entry changed in between it returns ErrConflict.
+	SaveIfVersion(key model.Key, model model.Model, version string) (string, error)
+
+	// DeleteIfVersion deletes key only if the stored entry still has version.
+	// It returns ErrNotFound if there is no entry and ErrConflict if the entry
+	// has another version.
+	DeleteIfVersion(key model.Key, version string) error
+
+	// The Context variants give up when ctx is done, as in ContextDB.
+	GetVersionContext(ctx context.Context, key model.Key, model model.Model) (string, error)
+	SaveIfVersionContext(ctx context.Context, key model.Key, model model.Model, version string) (string, error)
+	DeleteIfVersionContext(ctx context.Context, key model.Key, version string) error
+}
+
+func versionOf(b []byte) string {
+	h := fnv.New64a()
+	h.Write(b)
+	return strconv.FormatUint(h.Sum64(), 16)
+}
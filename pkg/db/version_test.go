@@ -0,0 +1,63 @@
+package db
+
+import (
+	"context"
+	"testing"
+)
+
+func testVersioned(t *testing.T, v VersionedDB) {
+	key := testKey("a")
+	v1, err := v.SaveIfVersion(key, &testModel{Val: "1"}, "")
+	if err != nil {
+		t.Fatalf("SaveIfVersion on new key: %s", err)
+	}
+	if _, err := v.SaveIfVersion(key, &testModel{Val: "x"}, ""); err != ErrConflict {
+		t.Fatalf("SaveIfVersion(\"\") on existing key = %v, want ErrConflict", err)
+	}
+
+	var m testModel
+	got, err := v.GetVersion(key, &m)
+	if err != nil || got != v1 || m.Val != "1" {
+		t.Fatalf("GetVersion = %q, %q, %v; want %q, %q, nil", got, m.Val, err, v1, "1")
+	}
+
+	v2, err := v.SaveIfVersion(key, &testModel{Val: "2"}, v1)
+	if err != nil || v2 == v1 {
+		t.Fatalf("SaveIfVersion = %q, %v; want a new version", v2, err)
+	}
+	if _, err := v.SaveIfVersion(key, &testModel{Val: "3"}, v1); err != ErrConflict {
+		t.Fatalf("SaveIfVersion with stale version = %v, want ErrConflict", err)
+	}
+	if _, err := v.GetVersion(testKey("missing"), &m); err != ErrNotFound {
+		t.Fatalf("GetVersion(missing) = %v, want ErrNotFound", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := v.GetVersionContext(ctx, key, &m); err != context.Canceled {
+		t.Fatalf("GetVersionContext with canceled ctx = %v, want context.Canceled", err)
+	}
+	if err := v.DeleteIfVersionContext(ctx, key, v2); err != context.Canceled {
+		t.Fatalf("DeleteIfVersionContext with canceled ctx = %v, want context.Canceled", err)
+	}
+	if err := v.DeleteIfVersion(key, v1); err != ErrConflict {
+		t.Fatalf("DeleteIfVersion with stale version = %v, want ErrConflict", err)
+	}
+	if err := v.DeleteIfVersion(key, v2); err != nil {
+		t.Fatalf("DeleteIfVersion: %s", err)
+	}
+	if err := v.DeleteIfVersion(key, v2); err != ErrNotFound {
+		t.Fatalf("DeleteIfVersion of deleted key = %v, want ErrNotFound", err)
+	}
+}
+
+func TestMemVersioned(t *testing.T) {
+	testVersioned(t, NewMem())
+	testVersioned(t, NewMemCopy())
+}
+
+func TestRedisVersioned(t *testing.T) {
+	r, s := newTestRedis(t)
+	defer s.Close()
+	testVersioned(t, r)
+}
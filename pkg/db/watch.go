@@ -0,0 +1,96 @@
+package db
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// Op is the kind of change an Event reports.
+type Op string
+
+const (
+	OpSave   Op = "save"
+	OpDelete Op = "delete"
+)
+
+// Event describes one write to a store. Value holds the MarshalBinary form of
+// the saved model and is nil for deletes.
+type Event struct {
+	Key   string
+	Op    Op
+	Value []byte
+}
+
+// Watcher is implemented by backends that publish their writes.
+type Watcher interface {
+	// Watch delivers events for keys starting with prefix until ctx is done,
+	// at which point the channel is closed.
+	Watch(ctx context.Context, prefix string) (<-chan Event, error)
+}
+
+// feedBuffer is the channel capacity of each in-process subscriber.
+const feedBuffer = 64
+
+// feed fans events out to in-process subscribers. A subscriber whose buffer
+// is full misses the event rather than blocking the writer; Dropped counts
+// how often that happened.
+type feed struct {
+	mx      sync.RWMutex
+	subs    map[*subscriber]struct{}
+	n       int32 // len(subs), readable without the lock
+	dropped uint64
+}
+
+type subscriber struct {
+	prefix string
+	ch     chan Event
+}
+
+func (f *feed) subscribe(ctx context.Context, prefix string) <-chan Event {
+	s := &subscriber{prefix: prefix, ch: make(chan Event, feedBuffer)}
+	f.mx.Lock()
+	if f.subs == nil {
+		f.subs = make(map[*subscriber]struct{})
+	}
+	f.subs[s] = struct{}{}
+	atomic.AddInt32(&f.n, 1)
+	f.mx.Unlock()
+
+	go func() {
+		<-ctx.Done()
+		f.mx.Lock()
+		delete(f.subs, s)
+		atomic.AddInt32(&f.n, -1)
+		f.mx.Unlock()
+		close(s.ch)
+	}()
+	return s.ch
+}
+
+// active reports whether anyone is listening, so writers can skip building
+// events nobody will read.
+func (f *feed) active() bool {
+	return atomic.LoadInt32(&f.n) > 0
+}
+
+func (f *feed) publish(ev Event) {
+	f.mx.RLock()
+	defer f.mx.RUnlock()
+	for s := range f.subs {
+		if !strings.HasPrefix(ev.Key, s.prefix) {
+			continue
+		}
+		select {
+		case s.ch <- ev:
+		default:
+			atomic.AddUint64(&f.dropped, 1)
+		}
+	}
+}
+
+// Dropped returns the number of events not delivered to slow subscribers.
+func (f *feed) Dropped() uint64 {
+	return atomic.LoadUint64(&f.dropped)
+}
@@ -0,0 +1,80 @@
+package db
+
+import (
+	"context"
+	"gopkg.in/redis.v5"
+	"testing"
+	"time"
+)
+
+func nextEvent(t *testing.T, ch <-chan Event) Event {
+	select {
+	case ev, ok := <-ch:
+		if !ok {
+			t.Fatal("event channel closed")
+		}
+		return ev
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for event")
+	}
+	return Event{}
+}
+
+func testWatch(t *testing.T, d interface {
+	DB
+	Watcher
+}) {
+	ctx, cancel := context.WithCancel(context.Background())
+	ch, err := d.Watch(ctx, "user/")
+	if err != nil {
+		t.Fatalf("Watch: %s", err)
+	}
+
+	d.Save(testKey("order/1"), &testModel{Val: "ignored"})
+	d.Save(testKey("user/1"), &testModel{Val: "a"})
+	d.Delete(testKey("user/missing"))
+	d.Delete(testKey("user/1"))
+
+	if ev := nextEvent(t, ch); ev.Key != "user/1" || ev.Op != OpSave || string(ev.Value) != "a" {
+		t.Fatalf("first event = %+v, want save of user/1", ev)
+	}
+	if ev := nextEvent(t, ch); ev.Key != "user/1" || ev.Op != OpDelete || ev.Value != nil {
+		t.Fatalf("second event = %+v, want delete of user/1", ev)
+	}
+
+	cancel()
+	for range ch {
+	}
+}
+
+func TestMemWatch(t *testing.T) {
+	testWatch(t, NewMem())
+}
+
+func TestMemWatchSlowConsumer(t *testing.T) {
+	m := NewMem()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	m.Watch(ctx, "")
+	for i := 0; i < feedBuffer+3; i++ {
+		m.Save(testKey("k"), &testModel{})
+	}
+	if n := m.DroppedEvents(); n != 3 {
+		t.Fatalf("DroppedEvents = %d, want 3", n)
+	}
+}
+
+func TestRedisWatch(t *testing.T) {
+	r, s := newTestRedis(t)
+	defer s.Close()
+	r.PublishChanges()
+	testWatch(t, r)
+}
+
+func TestRedisWatchCluster(t *testing.T) {
+	client := redis.NewClusterClient(&redis.ClusterOptions{Addrs: []string{"127.0.0.1:0"}})
+	defer client.Close()
+	if _, err := NewRedis(client).Watch(context.Background(), ""); err != errNoPubSub {
+		t.Fatalf("Watch on a cluster client = %v, want errNoPubSub", err)
+	}
+}
@@ -0,0 +1,186 @@
+package handler
+
+import (
+	"encoding"
+	"encoding/json"
+	"errors"
+	"mime"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// codec converts values to and from one wire format.
+type codec interface {
+	// MediaTypes lists the media types the codec is selected for, the one
+	// sent in Content-Type first.
+	MediaTypes() []string
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(data []byte, v interface{}) error
+}
+
+var (
+	jsonCodec    codec = jsonFormat{}
+	msgpackCodec codec = msgpackFormat{}
+	binaryCodec  codec = binaryFormat{}
+
+	// modelCodecs can encode a single model; the first is the default.
+	modelCodecs = []codec{jsonCodec, msgpackCodec, binaryCodec}
+	// valueCodecs can encode any JSON-like value, e.g. a list page.
+	valueCodecs = []codec{jsonCodec, msgpackCodec}
+	// patchCodecs decode a PATCH body over a stored model.
+	patchCodecs = []codec{mergePatchFormat{}, msgpackCodec}
+)
+
+type jsonFormat struct{}
+
+func (jsonFormat) MediaTypes() []string {
+	return []string{"application/json"}
+}
+
+func (jsonFormat) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (jsonFormat) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+// mergePatchFormat decodes JSON merge patches, and plain JSON used as one.
+type mergePatchFormat struct {
+	jsonFormat
+}
+
+func (mergePatchFormat) MediaTypes() []string {
+	return []string{"application/merge-patch+json", "application/json"}
+}
+
+// binaryFormat is the model's own MarshalBinary form.
+type binaryFormat struct{}
+
+var errNotBinary = errors.New("value has no binary form")
+
+func (binaryFormat) MediaTypes() []string {
+	return []string{"application/octet-stream"}
+}
+
+func (binaryFormat) Marshal(v interface{}) ([]byte, error) {
+	m, ok := v.(encoding.BinaryMarshaler)
+	if !ok {
+		return nil, errNotBinary
+	}
+	return m.MarshalBinary()
+}
+
+func (binaryFormat) Unmarshal(data []byte, v interface{}) error {
+	u, ok := v.(encoding.BinaryUnmarshaler)
+	if !ok {
+		return errNotBinary
+	}
+	return u.UnmarshalBinary(data)
+}
+
+// requestCodec picks the codec for the request body from its Content-Type.
+// On failure it writes a 415 and returns false.
+func requestCodec(w http.ResponseWriter, r *http.Request, codecs []codec) (codec, bool) {
+	mt, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err == nil {
+		for _, c := range codecs {
+			if contains(c.MediaTypes(), mt) {
+				return c, true
+			}
+		}
+	}
+	writeError(w, http.StatusUnsupportedMediaType, "unsupported content type "+r.Header.Get("Content-Type")+
+		", supported: "+strings.Join(mediaTypes(codecs), ", "))
+	return nil, false
+}
+
+// responseCodec picks the codec for the response from the Accept header,
+// preferring higher q-values and then the order of codecs. On failure it
+// writes a 406 and returns false.
+func responseCodec(w http.ResponseWriter, r *http.Request, codecs []codec) (codec, bool) {
+	w.Header().Add("Vary", "Accept")
+	accept := r.Header.Get("Accept")
+	if strings.TrimSpace(accept) == "" {
+		return codecs[0], true
+	}
+	for _, rng := range acceptRanges(accept) {
+		for _, c := range codecs {
+			for _, mt := range c.MediaTypes() {
+				if rng.matches(mt) {
+					return c, true
+				}
+			}
+		}
+	}
+	writeError(w, http.StatusNotAcceptable, "cannot produce "+accept+
+		", available: "+strings.Join(mediaTypes(codecs), ", "))
+	return nil, false
+}
+
+// writeEncoded writes v encoded with c.
+func writeEncoded(w http.ResponseWriter, c codec, code int, v interface{}) {
+	b, err := c.Marshal(v)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "encoding response: "+err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", c.MediaTypes()[0])
+	w.WriteHeader(code)
+	w.Write(b)
+}
+
+type acceptRange struct {
+	typ, subtype string
+	q            float64
+}
+
+func (a acceptRange) matches(mediaType string) bool {
+	typ, subtype := splitMediaType(mediaType)
+	return (a.typ == "*" || a.typ == typ) && (a.subtype == "*" || a.subtype == subtype)
+}
+
+// acceptRanges parses an Accept header into the ranges it allows, best first.
+// Malformed ranges and ranges with q=0 are left out.
+func acceptRanges(accept string) []acceptRange {
+	var ranges []acceptRange
+	for _, part := range strings.Split(accept, ",") {
+		mt, params, err := mime.ParseMediaType(part)
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if s, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(s, 64); err != nil {
+				continue
+			}
+		}
+		if q <= 0 {
+			continue
+		}
+		typ, subtype := splitMediaType(mt)
+		ranges = append(ranges, acceptRange{typ: typ, subtype: subtype, q: q})
+	}
+	sort.SliceStable(ranges, func(i, j int) bool {
+		return ranges[i].q > ranges[j].q
+	})
+	return ranges
+}
+
+func splitMediaType(mt string) (typ, subtype string) {
+	i := strings.IndexByte(mt, '/')
+	if i < 0 {
+		return mt, ""
+	}
+	return mt[:i], mt[i+1:]
+}
+
+func mediaTypes(codecs []codec) []string {
+	var types []string
+	for _, c := range codecs {
+		types = append(types, c.MediaTypes()[0])
+	}
+	return types
+}
@@ -0,0 +1,117 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/gorilla/mux"
+	"github.com/llitfkitfk/GoHighPerformance/pkg/db"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestMsgpack(t *testing.T) {
+	// {"count":3,"name":"bolt"}, keys sorted
+	want := []byte{0x82, 0xa5, 'c', 'o', 'u', 'n', 't', 0x03, 0xa4, 'n', 'a', 'm', 'e', 0xa4, 'b', 'o', 'l', 't'}
+	b, err := msgpackCodec.Marshal(&widget{Name: "bolt", Count: 3})
+	if err != nil || !bytes.Equal(b, want) {
+		t.Fatalf("Marshal = % x, %v; want % x", b, err, want)
+	}
+	var got widget
+	if err := msgpackCodec.Unmarshal(b, &got); err != nil || got != (widget{"bolt", 3}) {
+		t.Fatalf("Unmarshal = %+v, %v", got, err)
+	}
+
+	for _, v := range []interface{}{
+		int64(-1), int64(-33), int64(200), int64(-40000), int64(1 << 40), uint64(1 << 63), 1.5,
+		"", string(bytes.Repeat([]byte("x"), 300)), []interface{}{true, false, nil},
+	} {
+		b, err := msgpackCodec.Marshal(v)
+		if err != nil {
+			t.Fatalf("Marshal(%v): %s", v, err)
+		}
+		var back json.RawMessage
+		if err := msgpackCodec.Unmarshal(b, &back); err != nil {
+			t.Fatalf("Unmarshal(Marshal(%v)): %s", v, err)
+		}
+		if j, _ := jsonCodec.Marshal(v); !bytes.Equal(j, back) {
+			t.Errorf("round trip of %s gave %s", j, back)
+		}
+	}
+
+	for _, bad := range [][]byte{{0x82, 0xa5}, {0xc1}, {0x81, 0x01, 0x02}, {0x01, 0x02}, {0xdd, 0xff, 0xff, 0xff, 0xff}} {
+		var v interface{}
+		if err := msgpackCodec.Unmarshal(bad, &v); err == nil {
+			t.Errorf("Unmarshal(% x) succeeded", bad)
+		}
+	}
+
+	// []byte goes out as its base64 str, as in JSON, and comes back from a bin too
+	type blob struct {
+		Data []byte `json:"data"`
+	}
+	b, err = msgpackCodec.Marshal(blob{[]byte{1, 2}})
+	if want := []byte{0x81, 0xa4, 'd', 'a', 't', 'a', 0xa4, 'A', 'Q', 'I', '='}; err != nil || !bytes.Equal(b, want) {
+		t.Fatalf("Marshal([]byte) = % x, %v; want % x", b, err, want)
+	}
+	var bl blob
+	bin := []byte{0x81, 0xa4, 'd', 'a', 't', 'a', 0xc4, 0x02, 1, 2}
+	if err := msgpackCodec.Unmarshal(bin, &bl); err != nil || !bytes.Equal(bl.Data, []byte{1, 2}) {
+		t.Fatalf("Unmarshal(bin) = %v, %v", bl.Data, err)
+	}
+}
+
+func TestNegotiation(t *testing.T) {
+	mem := db.NewMem()
+	mem.Save(widgetKey("n"), &widget{Name: "nut", Count: 7})
+	router := mux.NewRouter()
+	RegisterResources(router, mem)
+
+	for _, c := range []struct {
+		accept, contentType string
+		code                int
+	}{
+		{"", "application/json", http.StatusOK},
+		{"*/*", "application/json", http.StatusOK},
+		{"application/msgpack", "application/msgpack", http.StatusOK},
+		{"application/json;q=0.5, application/octet-stream", "application/octet-stream", http.StatusOK},
+		{"application/*;q=0.1, text/html", "application/json", http.StatusOK},
+		{"text/html", "", http.StatusNotAcceptable},
+		{"application/json;q=0", "", http.StatusNotAcceptable},
+	} {
+		w := do(t, router, "GET", "/widgets/n", nil, "Accept", c.accept)
+		if w.Code != c.code || (c.contentType != "" && w.Header().Get("Content-Type") != c.contentType) {
+			t.Errorf("Accept %q: %d %q, want %d %q", c.accept, w.Code, w.Header().Get("Content-Type"), c.code, c.contentType)
+			continue
+		}
+		if c.code != http.StatusOK {
+			continue
+		}
+		// what comes back decodes with the same codec into the stored widget
+		var got widget
+		r := httptest.NewRequest("PUT", "/widgets/m", w.Body)
+		r.Header.Set("Content-Type", c.contentType)
+		pw := httptest.NewRecorder()
+		router.ServeHTTP(pw, r)
+		if pw.Code != http.StatusNoContent {
+			t.Fatalf("PUT %s: code = %d; %s", c.contentType, pw.Code, pw.Body)
+		}
+		if err := mem.Get(widgetKey("m"), &got); err != nil || got != (widget{"nut", 7}) {
+			t.Errorf("PUT %s stored %+v, %v", c.contentType, got, err)
+		}
+	}
+
+	w := do(t, router, "GET", "/widgets", nil, "Accept", "application/octet-stream")
+	if w.Code != http.StatusNotAcceptable {
+		t.Errorf("list as octet-stream: code = %d, want 406", w.Code)
+	}
+	w = do(t, router, "PATCH", "/widgets/n", bytes.NewReader([]byte{0x81, 0xa5, 'c', 'o', 'u', 'n', 't', 0x08}),
+		"Content-Type", "application/x-msgpack")
+	if w.Code != http.StatusOK {
+		t.Errorf("msgpack PATCH: code = %d; %s", w.Code, w.Body)
+	}
+	w = do(t, router, "PATCH", "/widgets/n", bytes.NewReader(nil), "Content-Type", "application/octet-stream")
+	if w.Code != http.StatusUnsupportedMediaType {
+		t.Errorf("octet-stream PATCH: code = %d, want 415", w.Code)
+	}
+}
@@ -3,11 +3,12 @@ package handler
 import (
 	"github.com/gorilla/mux"
 	"github.com/llitfkitfk/GoHighPerformance/pkg/db"
+	"github.com/llitfkitfk/GoHighPerformance/pkg/model"
 	"net/http"
 )
 
 type CreateHandler struct {
-	db db.DB
+	db db.ContextDB
 }
 
 type Test string
@@ -20,14 +21,36 @@ func (t Test) Implement()  {
 
 }
 
-func NewCreateHandler(db db.DB) *CreateHandler {
-	return &CreateHandler{db: db}
+func NewCreateHandler(database db.DB) *CreateHandler {
+	return &CreateHandler{db: db.WithContext(database)}
 }
 
 func (c *CreateHandler) RegisterRoute(r *mux.Router) {
-	r.Handle("/test", c).Methods("POST")
+	r.Handle("/{kind}", c).Methods("POST")
 }
 
+// ServeHTTP stores the body as a new resource under a random id and points
+// the Location header at it.
 func (c *CreateHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-
+	name := mux.Vars(r)["kind"]
+	k, ok := model.Lookup(name)
+	if !ok {
+		writeError(w, http.StatusNotFound, "unknown kind "+name)
+		return
+	}
+	md := k.New()
+	if !decodeBody(w, r, md) {
+		return
+	}
+	id, err := newID()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if err := c.db.SaveContext(r.Context(), k.Key(id), md); err != nil {
+		writeError(w, errorStatus(err), err.Error())
+		return
+	}
+	w.Header().Set("Location", "/"+name+"/"+id)
+	w.WriteHeader(http.StatusCreated)
 }
@@ -0,0 +1,104 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/gorilla/mux"
+	"github.com/llitfkitfk/GoHighPerformance/pkg/db"
+	"github.com/llitfkitfk/GoHighPerformance/pkg/model"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type widgetKey string
+
+func (k widgetKey) String() string {
+	return "widget:" + string(k)
+}
+
+type widget struct {
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+}
+
+func (w *widget) MarshalBinary() ([]byte, error) {
+	return json.Marshal(w)
+}
+
+func (w *widget) UnmarshalBinary(b []byte) error {
+	return json.Unmarshal(b, w)
+}
+
+func (w *widget) Set(m model.Model) error {
+	o, ok := m.(*widget)
+	if !ok {
+		return errors.New("not a *widget")
+	}
+	*w = *o
+	return nil
+}
+
+func init() {
+	model.Register("widgets",
+		func() model.Model { return new(widget) },
+		func(id string) model.Key { return widgetKey(id) })
+}
+
+func TestCreateHandler(t *testing.T) {
+	mem := db.NewMem()
+	router := mux.NewRouter()
+	NewCreateHandler(mem).RegisterRoute(router)
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("POST", "/widgets", strings.NewReader(`{"name":"bolt","count":3}`))
+	r.Header.Set("Content-Type", "application/json; charset=utf-8")
+	router.ServeHTTP(w, r)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("code = %d, want 201; body %s", w.Code, w.Body)
+	}
+	loc := w.Header().Get("Location")
+	if !strings.HasPrefix(loc, "/widgets/") {
+		t.Fatalf("Location = %q, want /widgets/{id}", loc)
+	}
+	var got widget
+	if err := mem.Get(widgetKey(strings.TrimPrefix(loc, "/widgets/")), &got); err != nil {
+		t.Fatalf("created widget not stored: %s", err)
+	}
+	if got != (widget{"bolt", 3}) {
+		t.Fatalf("stored %+v", got)
+	}
+}
+
+func TestCreateHandlerErrors(t *testing.T) {
+	router := mux.NewRouter()
+	NewCreateHandler(db.NewMem()).RegisterRoute(router)
+
+	big := `{"name":"` + strings.Repeat("x", int(MaxBodySize)) + `"}`
+	for _, c := range []struct {
+		path, contentType, body string
+		code                    int
+	}{
+		{"/widgets", "application/json", `{"name":`, http.StatusBadRequest},
+		{"/widgets", "text/plain", `{}`, http.StatusUnsupportedMediaType},
+		{"/widgets", "", `{}`, http.StatusUnsupportedMediaType},
+		{"/widgets", "application/json", big, http.StatusRequestEntityTooLarge},
+		{"/gadgets", "application/json", `{}`, http.StatusNotFound},
+	} {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("POST", c.path, strings.NewReader(c.body))
+		if c.contentType != "" {
+			r.Header.Set("Content-Type", c.contentType)
+		}
+		router.ServeHTTP(w, r)
+		if w.Code != c.code {
+			t.Errorf("POST %s %q: code = %d, want %d", c.path, c.contentType, w.Code, c.code)
+			continue
+		}
+		var e apiError
+		if err := json.NewDecoder(w.Body).Decode(&e); err != nil || e.Error.Status != c.code || e.Error.Message == "" {
+			t.Errorf("POST %s %q: error body = %+v (%v)", c.path, c.contentType, e, err)
+		}
+	}
+}
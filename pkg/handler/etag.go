@@ -0,0 +1,56 @@
+package handler
+
+import (
+	"github.com/llitfkitfk/GoHighPerformance/pkg/db"
+	"net/http"
+	"strings"
+)
+
+// ifMatch returns the entity tags a conditional write is predicated on, from
+// a comma separated If-Match list. ok is false when the request has no
+// If-Match header or uses If-Match: *. If-Match uses strong comparison, so
+// weak W/ tags are left out and a list of only weak tags matches nothing.
+func ifMatch(r *http.Request) (tags []string, ok bool) {
+	for _, h := range r.Header.Values("If-Match") {
+		for _, t := range strings.Split(h, ",") {
+			t = strings.TrimSpace(t)
+			switch {
+			case t == "*":
+				return nil, false
+			case len(t) >= 2 && t[0] == '"' && t[len(t)-1] == '"':
+				tags = append(tags, t[1:len(t)-1])
+			}
+			ok = ok || t != ""
+		}
+	}
+	return tags, ok
+}
+
+// matches reports whether version is one of the tags returned by ifMatch.
+func matches(tags []string, version string) bool {
+	for _, t := range tags {
+		if t == version {
+			return true
+		}
+	}
+	return false
+}
+
+// setETag exposes a db.VersionedDB version as a strong ETag.
+func setETag(w http.ResponseWriter, version string) {
+	w.Header().Set("ETag", `"`+version+`"`)
+}
+
+// errorStatus maps storage errors to HTTP status codes.
+func errorStatus(err error) int {
+	switch err {
+	case db.ErrNotFound:
+		return http.StatusNotFound
+	case db.ErrConflict:
+		return http.StatusPreconditionFailed
+	case db.ErrBadCursor:
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
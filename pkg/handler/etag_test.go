@@ -0,0 +1,42 @@
+package handler
+
+import (
+	"github.com/llitfkitfk/GoHighPerformance/pkg/db"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestIfMatch(t *testing.T) {
+	for _, tc := range []struct {
+		header string
+		tags   []string
+		ok     bool
+	}{
+		{`"abc"`, []string{"abc"}, true},
+		{`"abc", "def"`, []string{"abc", "def"}, true},
+		{`W/"abc"`, nil, true},
+		{`W/"abc", "def"`, []string{"def"}, true},
+		{"*", nil, false},
+		{"", nil, false},
+	} {
+		r := httptest.NewRequest("PUT", "/", nil)
+		if tc.header != "" {
+			r.Header.Set("If-Match", tc.header)
+		}
+		tags, ok := ifMatch(r)
+		if !reflect.DeepEqual(tags, tc.tags) || ok != tc.ok {
+			t.Errorf("ifMatch(%q) = %q, %v; want %q, %v", tc.header, tags, ok, tc.tags, tc.ok)
+		}
+	}
+	if matches([]string{"abc"}, "ab") || !matches([]string{"x", "abc"}, "abc") {
+		t.Error("matches compares tags wrongly")
+	}
+	if s := errorStatus(db.ErrConflict); s != http.StatusPreconditionFailed {
+		t.Errorf("errorStatus(ErrConflict) = %d, want 412", s)
+	}
+	if s := errorStatus(db.ErrBadCursor); s != http.StatusBadRequest {
+		t.Errorf("errorStatus(ErrBadCursor) = %d, want 400", s)
+	}
+}
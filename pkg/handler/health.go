@@ -0,0 +1,65 @@
+package handler
+
+import (
+	"context"
+	"github.com/gorilla/mux"
+	"github.com/llitfkitfk/GoHighPerformance/pkg/db"
+	"net/http"
+	"time"
+)
+
+// HealthHandler reports that the process is up. It does not look at any
+// dependency, so a struggling backend never gets the pod restarted.
+type HealthHandler struct{}
+
+func NewHealthHandler() *HealthHandler {
+	return &HealthHandler{}
+}
+
+func (h *HealthHandler) RegisterRoute(r *mux.Router) {
+	r.Handle("/healthz", h).Methods("GET")
+}
+
+func (h *HealthHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+// ReadyHandler reports whether the storage backend answers a ping within the
+// timeout, so traffic is only routed to pods that can serve it.
+type ReadyHandler struct {
+	db      db.DB
+	timeout time.Duration
+}
+
+type readyStatus struct {
+	Status   string `json:"status"`
+	Duration string `json:"duration"`
+	Error    string `json:"error,omitempty"`
+}
+
+func NewReadyHandler(database db.DB, timeout time.Duration) *ReadyHandler {
+	return &ReadyHandler{db: database, timeout: timeout}
+}
+
+func (h *ReadyHandler) RegisterRoute(r *mux.Router) {
+	r.Handle("/readyz", h).Methods("GET")
+}
+
+func (h *ReadyHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), h.timeout)
+	defer cancel()
+
+	start := time.Now()
+	err := db.Ping(ctx, h.db)
+	check := readyStatus{Status: "ok", Duration: time.Since(start).String()}
+	code := http.StatusOK
+	if err != nil {
+		check.Status = "unavailable"
+		check.Error = err.Error()
+		code = http.StatusServiceUnavailable
+	}
+	writeJSON(w, code, map[string]interface{}{
+		"status": check.Status,
+		"checks": map[string]readyStatus{"db": check},
+	})
+}
@@ -0,0 +1,58 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/gorilla/mux"
+	"github.com/llitfkitfk/GoHighPerformance/pkg/db"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+type downDB struct {
+	db.DB
+}
+
+func (downDB) Ping(context.Context) error {
+	return errors.New("connection refused")
+}
+
+func TestReadyHandler(t *testing.T) {
+	for _, c := range []struct {
+		db     db.DB
+		code   int
+		status string
+	}{
+		{db.NewMem(), http.StatusOK, "ok"},
+		{downDB{db.NewMem()}, http.StatusServiceUnavailable, "unavailable"},
+	} {
+		router := mux.NewRouter()
+		NewReadyHandler(c.db, time.Second).RegisterRoute(router)
+		NewHealthHandler().RegisterRoute(router)
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", "/readyz", nil))
+		if w.Code != c.code {
+			t.Fatalf("%T: /readyz code = %d, want %d", c.db, w.Code, c.code)
+		}
+		var body struct {
+			Status string
+			Checks map[string]readyStatus
+		}
+		if err := json.NewDecoder(w.Body).Decode(&body); err != nil {
+			t.Fatalf("decoding /readyz body: %s", err)
+		}
+		if body.Status != c.status || body.Checks["db"].Status != c.status {
+			t.Fatalf("%T: /readyz body = %+v, want status %q", c.db, body, c.status)
+		}
+
+		w = httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", "/healthz", nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("/healthz code = %d, want 200", w.Code)
+		}
+	}
+}
@@ -0,0 +1,34 @@
+package handler
+
+import (
+	"github.com/gorilla/mux"
+	"io"
+	"net/http"
+)
+
+// PrometheusWriter is implemented by anything that can write its metrics in
+// the Prometheus text format, such as db.Instrumented.
+type PrometheusWriter interface {
+	WritePrometheus(io.Writer) error
+}
+
+type MetricsHandler struct {
+	metrics []PrometheusWriter
+}
+
+func NewMetricsHandler(metrics ...PrometheusWriter) *MetricsHandler {
+	return &MetricsHandler{metrics: metrics}
+}
+
+func (m *MetricsHandler) RegisterRoute(r *mux.Router) {
+	r.Handle("/metrics", m).Methods("GET")
+}
+
+func (m *MetricsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	for _, pw := range m.metrics {
+		if err := pw.WritePrometheus(w); err != nil {
+			return
+		}
+	}
+}
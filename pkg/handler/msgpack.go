@@ -0,0 +1,93 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"github.com/vmihailenco/msgpack/v5"
+	"strconv"
+)
+
+// msgpackFormat is MessagePack (https://msgpack.org). Values go through
+// their JSON form, so json struct tags and MarshalJSON apply and a
+// MessagePack document carries exactly what the JSON one would: maps have
+// string keys, sorted so equal values encode to equal bytes, and integers
+// take the smallest format that holds them.
+//
+// A []byte field is therefore sent as a str holding its base64 form, as in
+// JSON, not as a bin. A bin value is accepted in its place on decode, since
+// it reaches the field as the same base64 string.
+type msgpackFormat struct{}
+
+func (msgpackFormat) MediaTypes() []string {
+	return []string{"application/msgpack", "application/x-msgpack", "application/vnd.msgpack"}
+}
+
+func (msgpackFormat) Marshal(v interface{}) ([]byte, error) {
+	j, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(j))
+	dec.UseNumber()
+	var generic interface{}
+	if err := dec.Decode(&generic); err != nil {
+		return nil, err
+	}
+	if generic, err = msgpackNumbers(generic); err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	enc := msgpack.NewEncoder(&buf).SetSortMapKeys(true)
+	enc.UseCompactInts(true)
+	if err := enc.Encode(generic); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (msgpackFormat) Unmarshal(data []byte, v interface{}) error {
+	r := bytes.NewReader(data)
+	generic, err := msgpack.NewDecoder(r).DecodeInterface()
+	if err != nil {
+		return err
+	}
+	if r.Len() != 0 {
+		return errors.New("msgpack: trailing data after value")
+	}
+	j, err := json.Marshal(generic)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(j, v)
+}
+
+// msgpackNumbers replaces, in place, the json.Numbers of a value decoded
+// with UseNumber by an int64, a uint64 or a float64, whichever holds it.
+func msgpackNumbers(v interface{}) (interface{}, error) {
+	var err error
+	switch v := v.(type) {
+	case json.Number:
+		if i, err := strconv.ParseInt(string(v), 10, 64); err == nil {
+			return i, nil
+		}
+		if u, err := strconv.ParseUint(string(v), 10, 64); err == nil {
+			return u, nil
+		}
+		return v.Float64()
+	case []interface{}:
+		for i := range v {
+			if v[i], err = msgpackNumbers(v[i]); err != nil {
+				return nil, err
+			}
+		}
+	case map[string]interface{}:
+		for k, e := range v {
+			if v[k], err = msgpackNumbers(e); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return v, nil
+}
@@ -0,0 +1,402 @@
+package handler
+
+import (
+	"github.com/gorilla/mux"
+	"github.com/llitfkitfk/GoHighPerformance/pkg/db"
+	"github.com/llitfkitfk/GoHighPerformance/pkg/model"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const (
+	defaultListLimit = 100
+	maxListLimit     = 1000
+
+	// patchAttempts bounds how often an unconditional PATCH is retried when
+	// another write lands between its read and its write.
+	patchAttempts = 3
+)
+
+// RegisterResources mounts create, list, get, replace, patch and delete for
+// every registered kind on /{kind} and /{kind}/{id}. The patterns match any
+// path of that shape, so call it after registering fixed routes like
+// /metrics.
+func RegisterResources(r *mux.Router, database db.DB) {
+	NewCreateHandler(database).RegisterRoute(r)
+	NewListHandler(database).RegisterRoute(r)
+	NewGetHandler(database).RegisterRoute(r)
+	NewReplaceHandler(database).RegisterRoute(r)
+	NewPatchHandler(database).RegisterRoute(r)
+	NewDeleteHandler(database).RegisterRoute(r)
+}
+
+// resource resolves the kind and key a /{kind}/{id} request refers to. On
+// failure it writes a 404 and returns false.
+func resource(w http.ResponseWriter, r *http.Request) (model.Kind, model.Key, bool) {
+	vars := mux.Vars(r)
+	k, ok := model.Lookup(vars["kind"])
+	if !ok {
+		writeError(w, http.StatusNotFound, "unknown kind "+vars["kind"])
+		return model.Kind{}, nil, false
+	}
+	return k, k.Key(vars["id"]), true
+}
+
+// GetHandler returns a stored model, with its version as ETag when the
+// backend supports versions.
+type GetHandler struct {
+	db        db.ContextDB
+	versioned db.VersionedDB
+}
+
+func NewGetHandler(database db.DB) *GetHandler {
+	v, _ := db.Versioned(database)
+	return &GetHandler{db: db.WithContext(database), versioned: v}
+}
+
+func (h *GetHandler) RegisterRoute(r *mux.Router) {
+	r.Handle("/{kind}/{id}", h).Methods("GET")
+}
+
+func (h *GetHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	k, key, ok := resource(w, r)
+	if !ok {
+		return
+	}
+	c, ok := responseCodec(w, r, modelCodecs)
+	if !ok {
+		return
+	}
+	md := k.New()
+	var err error
+	if h.versioned != nil {
+		var version string
+		if version, err = h.versioned.GetVersionContext(r.Context(), key, md); err == nil {
+			setETag(w, version)
+		}
+	} else {
+		err = h.db.GetContext(r.Context(), key, md)
+	}
+	if err != nil {
+		writeError(w, errorStatus(err), err.Error())
+		return
+	}
+	writeEncoded(w, c, http.StatusOK, md)
+}
+
+// ReplaceHandler stores the body under /{kind}/{id}, creating or replacing it.
+// With a versioned backend it honours If-Match, and If-None-Match: * to only
+// create.
+type ReplaceHandler struct {
+	db        db.ContextDB
+	versioned db.VersionedDB
+}
+
+func NewReplaceHandler(database db.DB) *ReplaceHandler {
+	v, _ := db.Versioned(database)
+	return &ReplaceHandler{db: db.WithContext(database), versioned: v}
+}
+
+func (h *ReplaceHandler) RegisterRoute(r *mux.Router) {
+	r.Handle("/{kind}/{id}", h).Methods("PUT")
+}
+
+func (h *ReplaceHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	k, key, ok := resource(w, r)
+	if !ok {
+		return
+	}
+	md := k.New()
+	if !decodeBody(w, r, md) {
+		return
+	}
+
+	tags, conditional := ifMatch(r)
+	create := r.Header.Get("If-None-Match") == "*"
+	if !conditional && !create {
+		if err := h.db.SaveContext(r.Context(), key, md); err != nil {
+			writeError(w, errorStatus(err), err.Error())
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	if h.versioned == nil {
+		writeError(w, http.StatusPreconditionFailed, "conditional requests are not supported by this backend")
+		return
+	}
+	// the version of a missing key is ""
+	var version string
+	if !create {
+		var err error
+		version, err = h.versioned.GetVersionContext(r.Context(), key, k.New())
+		if err == db.ErrNotFound || err == nil && !matches(tags, version) {
+			err = db.ErrConflict
+		}
+		if err != nil {
+			writeError(w, errorStatus(err), err.Error())
+			return
+		}
+	}
+	next, err := h.versioned.SaveIfVersionContext(r.Context(), key, md, version)
+	if err != nil {
+		writeError(w, errorStatus(err), err.Error())
+		return
+	}
+	setETag(w, next)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// PatchHandler decodes a JSON merge patch, or its MessagePack equivalent,
+// over the stored model, so the fields it names replace the stored ones and
+// the others are kept. With a versioned backend the read and the write are
+// checked against each other, and against If-Match when given.
+type PatchHandler struct {
+	db        db.ContextDB
+	versioned db.VersionedDB
+}
+
+func NewPatchHandler(database db.DB) *PatchHandler {
+	v, _ := db.Versioned(database)
+	return &PatchHandler{db: db.WithContext(database), versioned: v}
+}
+
+func (h *PatchHandler) RegisterRoute(r *mux.Router) {
+	r.Handle("/{kind}/{id}", h).Methods("PATCH")
+}
+
+func (h *PatchHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	k, key, ok := resource(w, r)
+	if !ok {
+		return
+	}
+	pc, ok := requestCodec(w, r, patchCodecs)
+	if !ok {
+		return
+	}
+	c, ok := responseCodec(w, r, modelCodecs)
+	if !ok {
+		return
+	}
+	patch, ok := readRequest(w, r)
+	if !ok {
+		return
+	}
+	tags, conditional := ifMatch(r)
+	if conditional && h.versioned == nil {
+		writeError(w, http.StatusPreconditionFailed, "conditional requests are not supported by this backend")
+		return
+	}
+
+	for attempt := 1; ; attempt++ {
+		stored := k.New()
+		var version string
+		var err error
+		if h.versioned != nil {
+			version, err = h.versioned.GetVersionContext(r.Context(), key, stored)
+		} else {
+			err = h.db.GetContext(r.Context(), key, stored)
+		}
+		if err != nil {
+			writeError(w, errorStatus(err), err.Error())
+			return
+		}
+		if conditional && !matches(tags, version) {
+			writeError(w, http.StatusPreconditionFailed, db.ErrConflict.Error())
+			return
+		}
+		md, err := clone(k, stored)
+		if err != nil {
+			writeError(w, errorStatus(err), err.Error())
+			return
+		}
+		if err := pc.Unmarshal(patch, md); err != nil {
+			writeError(w, http.StatusBadRequest, "decoding body: "+err.Error())
+			return
+		}
+
+		if h.versioned == nil {
+			if err := h.db.SaveContext(r.Context(), key, md); err != nil {
+				writeError(w, errorStatus(err), err.Error())
+				return
+			}
+			writeEncoded(w, c, http.StatusOK, md)
+			return
+		}
+		next, err := h.versioned.SaveIfVersionContext(r.Context(), key, md, version)
+		if err == db.ErrConflict && !conditional && attempt < patchAttempts {
+			continue
+		}
+		if err == db.ErrConflict && !conditional {
+			writeError(w, http.StatusConflict, "too many concurrent writes, try again")
+			return
+		}
+		if err != nil {
+			writeError(w, errorStatus(err), err.Error())
+			return
+		}
+		setETag(w, next)
+		writeEncoded(w, c, http.StatusOK, md)
+		return
+	}
+}
+
+// DeleteHandler deletes /{kind}/{id}, answering 404 if it does not exist.
+// With a versioned backend it honours If-Match, checking and deleting in one
+// DeleteIfVersion call. Without If-Match the existence check and the delete
+// are separate calls, so two concurrent deletes may both succeed.
+type DeleteHandler struct {
+	db        db.ContextDB
+	versioned db.VersionedDB
+}
+
+func NewDeleteHandler(database db.DB) *DeleteHandler {
+	v, _ := db.Versioned(database)
+	return &DeleteHandler{db: db.WithContext(database), versioned: v}
+}
+
+func (h *DeleteHandler) RegisterRoute(r *mux.Router) {
+	r.Handle("/{kind}/{id}", h).Methods("DELETE")
+}
+
+func (h *DeleteHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	k, key, ok := resource(w, r)
+	if !ok {
+		return
+	}
+	tags, conditional := ifMatch(r)
+	if !conditional {
+		err := h.db.GetContext(r.Context(), key, k.New())
+		if err == nil {
+			err = h.db.DeleteContext(r.Context(), key)
+		}
+		if err != nil {
+			writeError(w, errorStatus(err), err.Error())
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	if h.versioned == nil {
+		writeError(w, http.StatusPreconditionFailed, "conditional requests are not supported by this backend")
+		return
+	}
+	version, err := h.versioned.GetVersionContext(r.Context(), key, k.New())
+	if err == nil && !matches(tags, version) {
+		err = db.ErrConflict
+	}
+	if err == nil {
+		err = h.versioned.DeleteIfVersionContext(r.Context(), key, version)
+	}
+	if err != nil {
+		writeError(w, errorStatus(err), err.Error())
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// clone returns a deep copy of md, so that changing it cannot reach into a
+// model the backend still holds.
+func clone(k model.Kind, md model.Model) (model.Model, error) {
+	b, err := md.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	c := k.New()
+	if err := c.UnmarshalBinary(b); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// ListHandler pages through the models of a kind. It needs a backend that
+// implements db.Scanner and a key constructor that puts the id at the end of
+// the key, so that the key for id "" is the prefix of all others.
+type ListHandler struct {
+	db      db.DB
+	scanner db.Scanner
+}
+
+type listItem struct {
+	ID    string      `json:"id"`
+	Value model.Model `json:"value"`
+}
+
+type listPage struct {
+	Items []listItem `json:"items"`
+	Next  string     `json:"next,omitempty"`
+}
+
+func NewListHandler(database db.DB) *ListHandler {
+	s, _ := db.Scannable(database)
+	return &ListHandler{db: database, scanner: s}
+}
+
+func (h *ListHandler) RegisterRoute(r *mux.Router) {
+	r.Handle("/{kind}", h).Methods("GET")
+}
+
+// ServeHTTP answers ?cursor=&limit= with a page of items and the cursor of
+// the next page, if any.
+func (h *ListHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["kind"]
+	k, ok := model.Lookup(name)
+	if !ok {
+		writeError(w, http.StatusNotFound, "unknown kind "+name)
+		return
+	}
+	c, ok := responseCodec(w, r, valueCodecs)
+	if !ok {
+		return
+	}
+	if h.scanner == nil {
+		writeError(w, http.StatusNotImplemented, "listing is not supported by this backend")
+		return
+	}
+	limit := defaultListLimit
+	if s := r.URL.Query().Get("limit"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n <= 0 || n > maxListLimit {
+			writeError(w, http.StatusBadRequest, "limit must be between 1 and "+strconv.Itoa(maxListLimit))
+			return
+		}
+		limit = n
+	}
+
+	prefix := k.Key("").String()
+	names, next, err := h.scanner.Scan(prefix, r.URL.Query().Get("cursor"), limit)
+	if err != nil {
+		writeError(w, errorStatus(err), err.Error())
+		return
+	}
+	keys := make([]model.Key, len(names))
+	models := make([]model.Model, len(names))
+	for i, n := range names {
+		keys[i] = k.Key(strings.TrimPrefix(n, prefix))
+		models[i] = k.New()
+	}
+	errs := make([]error, len(keys))
+	if err := db.WithBatch(h.db).GetMany(keys, models); err != nil {
+		be, ok := err.(db.BatchError)
+		if !ok {
+			writeError(w, errorStatus(err), err.Error())
+			return
+		}
+		errs = be
+	}
+
+	page := listPage{Items: make([]listItem, 0, len(names)), Next: next}
+	for i, n := range names {
+		switch errs[i] {
+		case nil:
+			page.Items = append(page.Items, listItem{ID: strings.TrimPrefix(n, prefix), Value: models[i]})
+		case db.ErrNotFound:
+			// deleted since the scan
+		default:
+			writeError(w, errorStatus(errs[i]), errs[i].Error())
+			return
+		}
+	}
+	writeEncoded(w, c, http.StatusOK, page)
+}
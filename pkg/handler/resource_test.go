@@ -0,0 +1,187 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/gorilla/mux"
+	"github.com/llitfkitfk/GoHighPerformance/pkg/db"
+	"github.com/llitfkitfk/GoHighPerformance/pkg/model"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func do(t *testing.T, router *mux.Router, method, path string, body io.Reader, header ...string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, path, body)
+	if body != nil {
+		r.Header.Set("Content-Type", "application/json")
+	}
+	for i := 0; i+1 < len(header); i += 2 {
+		r.Header.Set(header[i], header[i+1])
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	return w
+}
+
+func TestResources(t *testing.T) {
+	router := mux.NewRouter()
+	// Mem's VersionedDB and Scanner must be reachable through the decorator
+	RegisterResources(router, db.NewInstrumented(db.NewMem()))
+
+	w := do(t, router, "PUT", "/widgets/a", strings.NewReader(`{"name":"bolt","count":1}`))
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("PUT: code = %d; body %s", w.Code, w.Body)
+	}
+	w = do(t, router, "PUT", "/widgets/a", strings.NewReader(`{}`), "If-None-Match", "*")
+	if w.Code != http.StatusPreconditionFailed {
+		t.Fatalf("PUT If-None-Match on existing: code = %d, want 412", w.Code)
+	}
+
+	w = do(t, router, "GET", "/widgets/a", nil)
+	etag := w.Header().Get("ETag")
+	if w.Code != http.StatusOK || etag == "" {
+		t.Fatalf("GET: code = %d, ETag %q", w.Code, etag)
+	}
+	var got widget
+	json.NewDecoder(w.Body).Decode(&got)
+	if got != (widget{"bolt", 1}) {
+		t.Fatalf("GET: body %+v", got)
+	}
+
+	w = do(t, router, "PATCH", "/widgets/a", strings.NewReader(`{"count":2}`), "If-Match", etag)
+	if w.Code != http.StatusOK || w.Header().Get("ETag") == etag {
+		t.Fatalf("PATCH: code = %d, ETag %q", w.Code, w.Header().Get("ETag"))
+	}
+	json.NewDecoder(w.Body).Decode(&got)
+	if got != (widget{"bolt", 2}) {
+		t.Fatalf("PATCH: body %+v", got)
+	}
+	stale := etag
+	etag = w.Header().Get("ETag")
+	w = do(t, router, "PATCH", "/widgets/a", strings.NewReader(`{"count":3}`), "If-Match", stale)
+	if w.Code != http.StatusPreconditionFailed {
+		t.Fatalf("PATCH with stale ETag: code = %d, want 412", w.Code)
+	}
+	w = do(t, router, "PUT", "/widgets/a", strings.NewReader(`{"name":"bolt","count":2}`), "If-Match", "W/"+etag)
+	if w.Code != http.StatusPreconditionFailed {
+		t.Fatalf("PUT with weak ETag: code = %d, want 412", w.Code)
+	}
+	w = do(t, router, "PUT", "/widgets/a", strings.NewReader(`{"name":"bolt","count":2}`), "If-Match", stale+", "+etag)
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("PUT with ETag list: code = %d; body %s", w.Code, w.Body)
+	}
+	if w = do(t, router, "DELETE", "/widgets/a", nil, "If-Match", stale); w.Code != http.StatusPreconditionFailed {
+		t.Fatalf("DELETE with stale ETag: code = %d, want 412", w.Code)
+	}
+
+	do(t, router, "PUT", "/widgets/b", strings.NewReader(`{"name":"nut"}`))
+	w = do(t, router, "GET", "/widgets?limit=1", nil)
+	var page struct {
+		Items []struct {
+			ID    string
+			Value widget
+		}
+		Next string
+	}
+	json.NewDecoder(w.Body).Decode(&page)
+	if w.Code != http.StatusOK || len(page.Items) != 1 || page.Items[0].ID != "a" || page.Next == "" {
+		t.Fatalf("list page 1: code = %d, %+v", w.Code, page)
+	}
+	w = do(t, router, "GET", "/widgets?limit=1&cursor="+page.Next, nil)
+	page.Items, page.Next = nil, ""
+	json.NewDecoder(w.Body).Decode(&page)
+	if len(page.Items) != 1 || page.Items[0].Value.Name != "nut" || page.Next != "" {
+		t.Fatalf("list page 2: %+v", page)
+	}
+
+	if w = do(t, router, "DELETE", "/widgets/a", nil); w.Code != http.StatusNoContent {
+		t.Fatalf("DELETE: code = %d", w.Code)
+	}
+	for _, method := range []string{"GET", "DELETE", "PATCH"} {
+		var body io.Reader
+		if method == "PATCH" {
+			body = strings.NewReader(`{}`)
+		}
+		if w = do(t, router, method, "/widgets/a", body); w.Code != http.StatusNotFound {
+			t.Errorf("%s deleted: code = %d, want 404", method, w.Code)
+		}
+	}
+	if w = do(t, router, "GET", "/gadgets/a", nil); w.Code != http.StatusNotFound {
+		t.Errorf("GET unknown kind: code = %d, want 404", w.Code)
+	}
+}
+
+type tagged struct {
+	Tags  map[string]string `json:"tags"`
+	Count int               `json:"count"`
+}
+
+func (t *tagged) MarshalBinary() ([]byte, error) {
+	return json.Marshal(t)
+}
+
+func (t *tagged) UnmarshalBinary(b []byte) error {
+	return json.Unmarshal(b, t)
+}
+
+func (t *tagged) Set(m model.Model) error {
+	o, ok := m.(*tagged)
+	if !ok {
+		return errors.New("not a *tagged")
+	}
+	*t = *o
+	return nil
+}
+
+func init() {
+	model.Register("tagged",
+		func() model.Model { return new(tagged) },
+		func(id string) model.Key { return widgetKey(id) })
+}
+
+func TestPatchLeavesStoredModel(t *testing.T) {
+	mem := db.NewMem() // stores the saved model itself, maps and all
+	router := mux.NewRouter()
+	RegisterResources(router, mem)
+
+	do(t, router, "PUT", "/tagged/a", strings.NewReader(`{"tags":{"a":"1"}}`))
+	// the tags decode before count fails, so an in-place patch would leave them
+	w := do(t, router, "PATCH", "/tagged/a", strings.NewReader(`{"tags":{"b":"2"},"count":"x"}`))
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("PATCH: code = %d, want 400", w.Code)
+	}
+	var got tagged
+	mem.Get(widgetKey("a"), &got)
+	if len(got.Tags) != 1 {
+		t.Fatalf("stored tags after a failed PATCH = %v, want only a", got.Tags)
+	}
+}
+
+func TestResourcesAreInstrumented(t *testing.T) {
+	instrumented := db.NewInstrumented(db.NewCoalesced(db.NewMem()))
+	router := mux.NewRouter()
+	NewMetricsHandler(instrumented).RegisterRoute(router)
+	RegisterResources(router, instrumented)
+
+	do(t, router, "PUT", "/widgets/a", strings.NewReader(`{"name":"bolt"}`))
+	for i := 0; i < 5; i++ {
+		do(t, router, "GET", "/widgets/a", nil)
+	}
+	do(t, router, "PATCH", "/widgets/a", strings.NewReader(`{"count":2}`))
+	do(t, router, "GET", "/widgets", nil)
+
+	metrics := do(t, router, "GET", "/metrics", nil).Body.String()
+	for _, want := range []string{
+		`db_operation_duration_seconds_count{op="get"} 6`, // 5 GETs and the PATCH's read
+		`db_operation_duration_seconds_count{op="save"} 2`,
+		`db_operation_duration_seconds_count{op="scan"} 1`,
+		`db_operation_duration_seconds_count{op="get_many"} 1`,
+	} {
+		if !strings.Contains(metrics, want+"\n") {
+			t.Errorf("/metrics is missing %q", want)
+		}
+	}
+}
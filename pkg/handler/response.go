@@ -0,0 +1,101 @@
+package handler
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"github.com/llitfkitfk/GoHighPerformance/pkg/model"
+	"io"
+	"io/ioutil"
+	"net/http"
+)
+
+// MaxBodySize is the largest request body a handler reads.
+var MaxBodySize int64 = 1 << 20
+
+var errTooLarge = errors.New("request body too large")
+
+// apiError is the body of every error response.
+type apiError struct {
+	Error struct {
+		Status  int    `json:"status"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, code int, msg string) {
+	var e apiError
+	e.Error.Status = code
+	e.Error.Message = msg
+	writeJSON(w, code, e)
+}
+
+// readBody reads at most MaxBodySize bytes of the request body.
+func readBody(r *http.Request) ([]byte, error) {
+	b, err := ioutil.ReadAll(io.LimitReader(r.Body, MaxBodySize+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(b)) > MaxBodySize {
+		return nil, errTooLarge
+	}
+	return b, nil
+}
+
+// readRequest reads the request body. On failure it writes the error
+// response and returns false.
+func readRequest(w http.ResponseWriter, r *http.Request) ([]byte, bool) {
+	b, err := readBody(r)
+	switch {
+	case err == errTooLarge:
+		writeError(w, http.StatusRequestEntityTooLarge, err.Error())
+		return nil, false
+	case err != nil:
+		writeError(w, http.StatusBadRequest, err.Error())
+		return nil, false
+	}
+	return b, true
+}
+
+// decodeBody fills md from the request body in the format its Content-Type
+// names. On failure it writes the error response and returns false.
+func decodeBody(w http.ResponseWriter, r *http.Request, md model.Model) bool {
+	c, ok := requestCodec(w, r, modelCodecs)
+	if !ok {
+		return false
+	}
+	b, ok := readRequest(w, r)
+	if !ok {
+		return false
+	}
+	if err := c.Unmarshal(b, md); err != nil {
+		writeError(w, http.StatusBadRequest, "decoding body: "+err.Error())
+		return false
+	}
+	return true
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// newID returns a random resource id.
+func newID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
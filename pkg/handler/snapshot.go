@@ -0,0 +1,29 @@
+package handler
+
+import (
+	"github.com/gorilla/mux"
+	"github.com/llitfkitfk/GoHighPerformance/pkg/db"
+	"net/http"
+)
+
+// SnapshotHandler writes a snapshot of the store on demand.
+type SnapshotHandler struct {
+	s    db.Snapshotter
+	path string
+}
+
+func NewSnapshotHandler(s db.Snapshotter, path string) *SnapshotHandler {
+	return &SnapshotHandler{s: s, path: path}
+}
+
+func (h *SnapshotHandler) RegisterRoute(r *mux.Router) {
+	r.Handle("/admin/snapshot", h).Methods("POST")
+}
+
+func (h *SnapshotHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if err := h.s.SaveSnapshot(h.path); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,111 @@
+package model
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"fmt"
+)
+
+// Encoding turns a T into its stored form and back. Implementations must be
+// usable as their zero value.
+type Encoding[T any] interface {
+	Encode(v *T) ([]byte, error)
+	Decode(data []byte, v *T) error
+}
+
+// JSON encodes with encoding/json.
+type JSON[T any] struct{}
+
+func (JSON[T]) Encode(v *T) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (JSON[T]) Decode(data []byte, v *T) error {
+	return json.Unmarshal(data, v)
+}
+
+// Gob encodes with encoding/gob.
+type Gob[T any] struct{}
+
+func (Gob[T]) Encode(v *T) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (Gob[T]) Decode(data []byte, v *T) error {
+	return gob.NewDecoder(bytes.NewReader(data)).Decode(v)
+}
+
+// Base implements Model for any T, stored in the encoding E. Use it directly
+// through an alias,
+//
+//	type Widget = model.Base[WidgetData, model.JSON[WidgetData]]
+//
+// or embed it in a struct to add methods. Its JSON form is that of Value, so
+// HTTP handlers see the plain T.
+type Base[T any, E Encoding[T]] struct {
+	Value T
+}
+
+// TypeError is returned by Set when the source is not the same kind of Base.
+type TypeError struct {
+	Want, Got Model
+}
+
+func (e *TypeError) Error() string {
+	return fmt.Sprintf("model: cannot Set %T from %T", e.Want, e.Got)
+}
+
+func (b *Base[T, E]) MarshalBinary() ([]byte, error) {
+	var e E
+	return e.Encode(&b.Value)
+}
+
+// UnmarshalBinary replaces Value with the decoded data. On error Value is
+// left unchanged.
+func (b *Base[T, E]) UnmarshalBinary(data []byte) error {
+	var (
+		e E
+		v T
+	)
+	if err := e.Decode(data, &v); err != nil {
+		return err
+	}
+	b.Value = v
+	return nil
+}
+
+// Set copies Value from m, which must be a *Base[T, E] or a type embedding
+// one. Anything else returns a *TypeError and leaves b unchanged. The copy
+// goes through E, so maps, slices and pointers in Value are not shared with
+// m: stores can hand out their entries through Set without callers changing
+// them.
+func (b *Base[T, E]) Set(m Model) error {
+	o, ok := m.(interface{ base() *Base[T, E] })
+	if !ok {
+		return &TypeError{Want: b, Got: m}
+	}
+	data, err := o.base().MarshalBinary()
+	if err != nil {
+		return err
+	}
+	return b.UnmarshalBinary(data)
+}
+
+func (b *Base[T, E]) base() *Base[T, E] {
+	return b
+}
+
+func (b *Base[T, E]) MarshalJSON() ([]byte, error) {
+	return json.Marshal(&b.Value)
+}
+
+// UnmarshalJSON decodes into the current Value, so fields missing from data
+// keep their values, as encoding/json does for structs.
+func (b *Base[T, E]) UnmarshalJSON(data []byte) error {
+	return json.Unmarshal(data, &b.Value)
+}
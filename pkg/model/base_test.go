@@ -0,0 +1,84 @@
+package model
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+type point struct {
+	X, Y int
+}
+
+type jsonPoint = Base[point, JSON[point]]
+
+type tags map[string]string
+
+// labelledPoint embeds a Base to add its own methods.
+type labelledPoint struct {
+	Base[point, Gob[point]]
+}
+
+func (p *labelledPoint) Label() string {
+	return "point"
+}
+
+func TestBase(t *testing.T) {
+	var _ Model = new(jsonPoint)
+	var _ Model = new(labelledPoint)
+
+	a := &jsonPoint{Value: point{1, 2}}
+	b, err := a.MarshalBinary()
+	if err != nil || string(b) != `{"X":1,"Y":2}` {
+		t.Fatalf("MarshalBinary = %s, %v", b, err)
+	}
+	var c jsonPoint
+	if err := c.UnmarshalBinary(b); err != nil || c.Value != a.Value {
+		t.Fatalf("UnmarshalBinary = %+v, %v", c.Value, err)
+	}
+	if err := c.UnmarshalBinary([]byte("{")); err == nil || c.Value != a.Value {
+		t.Fatalf("UnmarshalBinary of bad data = %+v, %v", c.Value, err)
+	}
+
+	g := &labelledPoint{}
+	g.Value = point{3, 4}
+	if b, err = g.MarshalBinary(); err != nil {
+		t.Fatalf("gob MarshalBinary: %s", err)
+	}
+	var h labelledPoint
+	if err := h.UnmarshalBinary(b); err != nil || h.Value != g.Value {
+		t.Fatalf("gob UnmarshalBinary = %+v, %v", h.Value, err)
+	}
+
+	var s labelledPoint
+	if err := s.Set(g); err != nil || s.Value != g.Value {
+		t.Fatalf("Set from embedding type = %+v, %v", s.Value, err)
+	}
+	// same T, different encoding
+	err = s.Set(a)
+	var te *TypeError
+	if !errors.As(err, &te) || te.Got != Model(a) {
+		t.Fatalf("Set with mismatched type = %v, want a *TypeError", err)
+	}
+	if s.Value != g.Value {
+		t.Fatal("failed Set changed the value")
+	}
+
+	src := &Base[tags, JSON[tags]]{Value: tags{"a": "1"}}
+	var dst Base[tags, JSON[tags]]
+	if err := dst.Set(src); err != nil {
+		t.Fatalf("Set map: %s", err)
+	}
+	dst.Value["b"] = "2"
+	if len(src.Value) != 1 {
+		t.Fatalf("Set shared the map: source is now %v", src.Value)
+	}
+
+	j, err := json.Marshal(a)
+	if err != nil || string(j) != `{"X":1,"Y":2}` {
+		t.Fatalf("json.Marshal = %s, %v", j, err)
+	}
+	if err := json.Unmarshal([]byte(`{"Y":5}`), a); err != nil || a.Value != (point{1, 5}) {
+		t.Fatalf("json.Unmarshal patch = %+v, %v", a.Value, err)
+	}
+}
@@ -0,0 +1,59 @@
+package model
+
+import (
+	"sort"
+	"sync"
+)
+
+// Kind describes a registered model type.
+type Kind struct {
+	Name string
+
+	// New returns a fresh, zero Model of the kind, ready to be filled by
+	// UnmarshalBinary or a DB's Get.
+	New func() Model
+
+	// Key returns the Key the resource with the given id is stored under.
+	// Generic listings expect the id to be a suffix of the key, so that
+	// Key("") is the prefix shared by every key of the kind.
+	Key func(id string) Key
+}
+
+var (
+	registryMx sync.RWMutex
+	registry   = make(map[string]Kind)
+)
+
+// Register makes a model type available under name. It is meant to be called
+// from init functions and panics if name is taken or a func is nil.
+func Register(name string, newModel func() Model, newKey func(id string) Key) {
+	registryMx.Lock()
+	defer registryMx.Unlock()
+	if newModel == nil || newKey == nil {
+		panic("model: Register func is nil for " + name)
+	}
+	if _, dup := registry[name]; dup {
+		panic("model: Register called twice for " + name)
+	}
+	registry[name] = Kind{Name: name, New: newModel, Key: newKey}
+}
+
+// Lookup returns the kind registered under name.
+func Lookup(name string) (Kind, bool) {
+	registryMx.RLock()
+	defer registryMx.RUnlock()
+	k, ok := registry[name]
+	return k, ok
+}
+
+// Kinds returns the sorted names of the registered kinds.
+func Kinds() []string {
+	registryMx.RLock()
+	defer registryMx.RUnlock()
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,58 @@
+package model
+
+import "testing"
+
+type testKey string
+
+func (k testKey) String() string {
+	return "test:" + string(k)
+}
+
+type testModel []byte
+
+func (t *testModel) MarshalBinary() ([]byte, error) {
+	return *t, nil
+}
+
+func (t *testModel) UnmarshalBinary(b []byte) error {
+	*t = append((*t)[:0], b...)
+	return nil
+}
+
+func (t *testModel) Set(m Model) error {
+	b, err := m.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	return t.UnmarshalBinary(b)
+}
+
+func TestRegistry(t *testing.T) {
+	Register("test-registry",
+		func() Model { return new(testModel) },
+		func(id string) Key { return testKey(id) })
+
+	k, ok := Lookup("test-registry")
+	if !ok {
+		t.Fatal("Lookup did not find the registered kind")
+	}
+	if k.Name != "test-registry" || k.Key("1").String() != "test:1" {
+		t.Fatalf("Lookup = %+v", k)
+	}
+	if a, b := k.New(), k.New(); a == b {
+		t.Fatal("New returned the same model twice")
+	}
+	if _, ok := Lookup("nope"); ok {
+		t.Fatal("Lookup found an unregistered kind")
+	}
+	if names := Kinds(); len(names) != 1 || names[0] != "test-registry" {
+		t.Fatalf("Kinds() = %v", names)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Fatal("registering a name twice did not panic")
+		}
+	}()
+	Register("test-registry", k.New, k.Key)
+}